@@ -0,0 +1,253 @@
+// Copyright 2014 The go-ethereum Authors
+// This file is part of the go-ethereum library.
+//
+// The go-ethereum library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-ethereum library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-ethereum library. If not, see <http://www.gnu.org/licenses/>.
+
+package core
+
+import (
+	"errors"
+	"ethereum-evm/core/rawdb"
+	"ethereum-evm/core/state"
+	"ethereum-evm/core/vm"
+	"ethereum-evm/ethdb"
+	"ethereum-evm/params"
+	"fmt"
+	"math/big"
+	"sync"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core/types"
+)
+
+var (
+	// ErrNoGenesis is returned when there is no genesis block in the database
+	// and none was supplied to create one.
+	ErrNoGenesis = errors.New("genesis not found in chain")
+
+	// errNotOnHead is returned when a block doesn't extend the current head.
+	errNotOnHead = errors.New("block does not extend the chain head")
+)
+
+// BlockChain represents the canonical chain given a database with a genesis
+// block. Headers, bodies, receipts and transaction lookups are kept through the
+// rawdb accessors, so a database with a freezer moves old blocks into it.
+//
+// Blocks can only be appended to the head, there are no side chains or reorgs.
+type BlockChain struct {
+	chainConfig *params.ChainConfig // Chain & network configuration
+	db          ethdb.Database      // Low level persistent database to store final content in
+	stateCache  state.Database      // State database to reuse between imports (contains state cache)
+	processor   *StateProcessor     // Block transaction processor interface
+	vmConfig    vm.Config
+
+	mu           sync.RWMutex // Guards the head of the chain
+	currentBlock *types.Block // Current head of the block chain
+}
+
+// NewBlockChain returns a fully initialised block chain using information
+// available in the database. The genesis is committed to the database if it
+// is empty, otherwise it must match the genesis the database was created with.
+func NewBlockChain(db ethdb.Database, genesis *Genesis, vmConfig vm.Config) (*BlockChain, error) {
+	bc := &BlockChain{
+		db:         db,
+		stateCache: state.NewDatabase(db),
+		vmConfig:   vmConfig,
+	}
+	stored := rawdb.ReadCanonicalHash(db, 0)
+	switch {
+	case stored == (common.Hash{}) && genesis == nil:
+		return nil, ErrNoGenesis
+
+	case stored == (common.Hash{}):
+		block, err := genesis.Commit(db, bc.stateCache)
+		if err != nil {
+			return nil, err
+		}
+		stored = block.Hash()
+
+	case genesis != nil:
+		if hash := genesis.ToBlock().Hash(); hash != stored {
+			return nil, fmt.Errorf("database contains incompatible genesis (have %x, new %x)", stored, hash)
+		}
+	}
+	bc.chainConfig = rawdb.ReadChainConfig(db, stored)
+	if bc.chainConfig == nil {
+		return nil, errors.New("found genesis block without chain config")
+	}
+	bc.processor = NewStateProcessor(bc.chainConfig, bc)
+
+	head := rawdb.ReadHeadBlock(db)
+	if head == nil {
+		return nil, errors.New("head block missing")
+	}
+	if _, err := bc.StateAt(head.Root()); err != nil {
+		return nil, fmt.Errorf("head state missing: %w", err)
+	}
+	bc.currentBlock = head
+	return bc, nil
+}
+
+// Config retrieves the chain's fork configuration.
+func (bc *BlockChain) Config() *params.ChainConfig { return bc.chainConfig }
+
+// Processor returns the current processor.
+func (bc *BlockChain) Processor() *StateProcessor { return bc.processor }
+
+// CurrentBlock retrieves the current head block of the canonical chain.
+func (bc *BlockChain) CurrentBlock() *types.Block {
+	bc.mu.RLock()
+	defer bc.mu.RUnlock()
+	return bc.currentBlock
+}
+
+// Genesis retrieves the chain's genesis block.
+func (bc *BlockChain) Genesis() *types.Block {
+	return bc.GetBlockByNumber(0)
+}
+
+// GetHeaderByHash retrieves a block header from the database by hash.
+func (bc *BlockChain) GetHeaderByHash(hash common.Hash) *types.Header {
+	number := rawdb.ReadHeaderNumber(bc.db, hash)
+	if number == nil {
+		return nil
+	}
+	return rawdb.ReadHeader(bc.db, hash, *number)
+}
+
+// GetHeader retrieves a block header from the database by hash and number.
+func (bc *BlockChain) GetHeader(hash common.Hash, number uint64) *types.Header {
+	return rawdb.ReadHeader(bc.db, hash, number)
+}
+
+// GetHeaderByNumber retrieves a canonical block header from the database by
+// number.
+func (bc *BlockChain) GetHeaderByNumber(number uint64) *types.Header {
+	hash := rawdb.ReadCanonicalHash(bc.db, number)
+	if hash == (common.Hash{}) {
+		return nil
+	}
+	return rawdb.ReadHeader(bc.db, hash, number)
+}
+
+// GetBlockByHash retrieves a block from the database by hash.
+func (bc *BlockChain) GetBlockByHash(hash common.Hash) *types.Block {
+	number := rawdb.ReadHeaderNumber(bc.db, hash)
+	if number == nil {
+		return nil
+	}
+	return rawdb.ReadBlock(bc.db, hash, *number)
+}
+
+// GetBlockByNumber retrieves a canonical block from the database by number.
+func (bc *BlockChain) GetBlockByNumber(number uint64) *types.Block {
+	hash := rawdb.ReadCanonicalHash(bc.db, number)
+	if hash == (common.Hash{}) {
+		return nil
+	}
+	return rawdb.ReadBlock(bc.db, hash, number)
+}
+
+// GetReceiptsByHash retrieves the receipts for all transactions in a given block.
+func (bc *BlockChain) GetReceiptsByHash(hash common.Hash) types.Receipts {
+	number := rawdb.ReadHeaderNumber(bc.db, hash)
+	if number == nil {
+		return nil
+	}
+	return rawdb.ReadReceipts(bc.db, hash, *number, bc.chainConfig)
+}
+
+// GetTransaction retrieves a canonical transaction together with the hash and
+// number of the block including it and its index in the block.
+func (bc *BlockChain) GetTransaction(hash common.Hash) (*types.Transaction, common.Hash, uint64, uint64) {
+	return rawdb.ReadTransaction(bc.db, hash)
+}
+
+// GetTd retrieves a block's total difficulty in the canonical chain from the
+// database by hash and number.
+func (bc *BlockChain) GetTd(hash common.Hash, number uint64) *big.Int {
+	return rawdb.ReadTd(bc.db, hash, number)
+}
+
+// State returns a new mutable state based on the current HEAD block.
+func (bc *BlockChain) State() (*state.StateDB, error) {
+	return bc.StateAt(bc.CurrentBlock().Root())
+}
+
+// StateAt returns a new mutable state based on a particular point in time.
+func (bc *BlockChain) StateAt(root common.Hash) (*state.StateDB, error) {
+	return state.New(root, bc.stateCache)
+}
+
+// InsertBlock executes the transactions of block on top of the head state,
+// validates the result against the header and appends the block to the chain.
+func (bc *BlockChain) InsertBlock(block *types.Block) error {
+	parent := bc.CurrentBlock()
+	if block.ParentHash() != parent.Hash() {
+		return errNotOnHead
+	}
+	statedb, err := bc.StateAt(parent.Root())
+	if err != nil {
+		return err
+	}
+	result, err := bc.processor.Process(block, statedb, bc.vmConfig)
+	if err != nil {
+		return err
+	}
+	if err := ValidateState(block.Header(), result); err != nil {
+		return err
+	}
+	return bc.WriteBlockAndSetHead(block, result.Receipts, statedb)
+}
+
+// WriteBlockAndSetHead commits the state the block was processed into, writes
+// the block with its receipts and makes it the new head of the chain.
+func (bc *BlockChain) WriteBlockAndSetHead(block *types.Block, receipts types.Receipts, statedb *state.StateDB) error {
+	bc.mu.Lock()
+	defer bc.mu.Unlock()
+
+	parent := bc.currentBlock
+	if block.ParentHash() != parent.Hash() || block.NumberU64() != parent.NumberU64()+1 {
+		return errNotOnHead
+	}
+	ptd := bc.GetTd(parent.Hash(), parent.NumberU64())
+	if ptd == nil {
+		return fmt.Errorf("total difficulty of parent %x missing", parent.Hash())
+	}
+	// Flush the state first, the block must never point to missing state.
+	root, err := statedb.Commit(bc.chainConfig.IsEIP158(block.Number()))
+	if err != nil {
+		return err
+	}
+	if root != block.Root() {
+		return fmt.Errorf("state root mismatch (block: %x state: %x)", block.Root(), root)
+	}
+	if err := statedb.Database().TrieDB().Commit(root, false, nil); err != nil {
+		return err
+	}
+	batch := bc.db.NewBatch()
+	rawdb.WriteTd(batch, block.Hash(), block.NumberU64(), new(big.Int).Add(block.Difficulty(), ptd))
+	rawdb.WriteBlock(batch, block)
+	rawdb.WriteReceipts(batch, block.Hash(), block.NumberU64(), receipts)
+	rawdb.WriteCanonicalHash(batch, block.Hash(), block.NumberU64())
+	rawdb.WriteTxLookupEntriesByBlock(batch, block)
+	rawdb.WriteHeadBlockHash(batch, block.Hash())
+	rawdb.WriteHeadFastBlockHash(batch, block.Hash())
+	rawdb.WriteHeadHeaderHash(batch, block.Hash())
+	if err := batch.Write(); err != nil {
+		return err
+	}
+	bc.currentBlock = block
+	return nil
+}
@@ -0,0 +1,207 @@
+package core
+
+import (
+	"crypto/ecdsa"
+	"errors"
+	"ethereum-evm/consensus/misc"
+	"ethereum-evm/core/rawdb"
+	"ethereum-evm/core/vm"
+	"ethereum-evm/ethdb/memorydb"
+	"ethereum-evm/params"
+	"ethereum-evm/trie"
+	"math/big"
+	"testing"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/crypto"
+)
+
+// newTestGenesis creates a London genesis in which addr owns one ether.
+func newTestGenesis(addr common.Address) *Genesis {
+	return &Genesis{
+		Config:   params.TestChainConfig,
+		GasLimit: 30000000,
+		BaseFee:  big.NewInt(params.InitialBaseFee),
+		Alloc:    GenesisAlloc{addr: {Balance: big.NewInt(ether)}},
+	}
+}
+
+// newChainBlock creates the block following the chain head that holds a
+// single transfer signed by key with the given nonce.
+func newChainBlock(t *testing.T, chain *BlockChain, key *ecdsa.PrivateKey, nonce uint64) *types.Block {
+	parent := chain.CurrentBlock()
+	header := &types.Header{
+		ParentHash: parent.Hash(),
+		Number:     new(big.Int).Add(parent.Number(), common.Big1),
+		Coinbase:   testCoinbase,
+		GasLimit:   parent.GasLimit(),
+		Time:       parent.Time() + 1,
+		Difficulty: new(big.Int),
+		BaseFee:    misc.CalcBaseFee(chain.Config(), parent.Header()),
+	}
+	to := common.HexToAddress("0x2000")
+	tx, err := types.SignNewTx(key, MakeSigner(chain.Config(), header.Number), &types.LegacyTx{
+		Nonce:    nonce,
+		To:       &to,
+		Value:    big.NewInt(1),
+		Gas:      params.TxGas,
+		GasPrice: big.NewInt(2 * params.InitialBaseFee),
+	})
+	if err != nil {
+		t.Fatalf("failed to sign transaction: %v", err)
+	}
+	txs := types.Transactions{tx}
+	statedb, err := chain.StateAt(parent.Root())
+	if err != nil {
+		t.Fatalf("failed to open parent state: %v", err)
+	}
+	result, err := chain.Processor().Process(types.NewBlockWithHeader(header).WithBody(txs, nil), statedb, vm.Config{})
+	if err != nil {
+		t.Fatalf("failed to process block: %v", err)
+	}
+	header.GasUsed = result.GasUsed
+	header.Root = result.Root
+	return types.NewBlock(header, txs, nil, result.Receipts, trie.NewStackTrie(nil))
+}
+
+func TestBlockChain(t *testing.T) {
+	var (
+		key, _  = crypto.GenerateKey()
+		from    = crypto.PubkeyToAddress(key.PublicKey)
+		genesis = newTestGenesis(from)
+		db      = rawdb.NewMemoryDatabase()
+	)
+	if _, err := NewBlockChain(db, nil, vm.Config{}); !errors.Is(err, ErrNoGenesis) {
+		t.Fatalf("empty database without genesis: have %v, want %v", err, ErrNoGenesis)
+	}
+	chain, err := NewBlockChain(db, genesis, vm.Config{})
+	if err != nil {
+		t.Fatalf("failed to create chain: %v", err)
+	}
+	var blocks []*types.Block
+	for i := uint64(0); i < 3; i++ {
+		block := newChainBlock(t, chain, key, i)
+		if err := chain.InsertBlock(block); err != nil {
+			t.Fatalf("block %d: failed to insert: %v", block.NumberU64(), err)
+		}
+		blocks = append(blocks, block)
+	}
+	// Blocks must extend the head and match the state they produce.
+	if err := chain.InsertBlock(blocks[1]); !errors.Is(err, errNotOnHead) {
+		t.Errorf("stale block: have %v, want %v", err, errNotOnHead)
+	}
+	bad := newChainBlock(t, chain, key, 3)
+	header := bad.Header()
+	header.Root = common.Hash{1}
+	if err := chain.InsertBlock(types.NewBlockWithHeader(header).WithBody(bad.Transactions(), nil)); err == nil {
+		t.Errorf("block with invalid state root inserted")
+	}
+	// The chain is served from the database and survives a restart.
+	chain, err = NewBlockChain(db, genesis, vm.Config{})
+	if err != nil {
+		t.Fatalf("failed to reopen chain: %v", err)
+	}
+	if head := chain.CurrentBlock(); head.Hash() != blocks[2].Hash() {
+		t.Fatalf("head mismatch: have %d %x, want 3 %x", head.NumberU64(), head.Hash(), blocks[2].Hash())
+	}
+	for _, block := range blocks {
+		if have := chain.GetBlockByNumber(block.NumberU64()); have == nil || have.Hash() != block.Hash() {
+			t.Errorf("block %d: canonical block mismatch", block.NumberU64())
+		}
+		tx := block.Transactions()[0]
+		if _, blockHash, number, index := chain.GetTransaction(tx.Hash()); blockHash != block.Hash() || number != block.NumberU64() || index != 0 {
+			t.Errorf("block %d: transaction lookup mismatch", block.NumberU64())
+		}
+		receipts := chain.GetReceiptsByHash(block.Hash())
+		if len(receipts) != 1 || receipts[0].TxHash != tx.Hash() || receipts[0].GasUsed != params.TxGas {
+			t.Errorf("block %d: receipts mismatch", block.NumberU64())
+		}
+	}
+	statedb, err := chain.State()
+	if err != nil {
+		t.Fatalf("failed to open head state: %v", err)
+	}
+	if nonce := statedb.GetNonce(from); nonce != 3 {
+		t.Errorf("nonce mismatch: have %d, want 3", nonce)
+	}
+	other := newTestGenesis(common.HexToAddress("0x1000"))
+	if _, err := NewBlockChain(db, other, vm.Config{}); err == nil {
+		t.Errorf("incompatible genesis accepted")
+	}
+}
+
+func TestBlockChainFreezer(t *testing.T) {
+	key, _ := crypto.GenerateKey()
+	db, err := rawdb.NewDatabaseWithFreezer(memorydb.New(), t.TempDir(), "", false)
+	if err != nil {
+		t.Fatalf("failed to create database: %v", err)
+	}
+	defer db.Close()
+
+	chain, err := NewBlockChain(db, newTestGenesis(crypto.PubkeyToAddress(key.PublicKey)), vm.Config{})
+	if err != nil {
+		t.Fatalf("failed to create chain: %v", err)
+	}
+	var blocks []*types.Block
+	for i := uint64(0); i < 4; i++ {
+		block := newChainBlock(t, chain, key, i)
+		if err := chain.InsertBlock(block); err != nil {
+			t.Fatalf("block %d: failed to insert: %v", block.NumberU64(), err)
+		}
+		blocks = append(blocks, block)
+	}
+	// Move everything but the last two blocks into the freezer.
+	if err := db.(interface{ Freeze(uint64) error }).Freeze(2); err != nil {
+		t.Fatalf("failed to freeze: %v", err)
+	}
+	if frozen, _ := db.Ancients(); frozen != 3 {
+		t.Fatalf("frozen block count mismatch: have %d, want 3", frozen)
+	}
+	for _, block := range blocks {
+		if have := chain.GetBlockByNumber(block.NumberU64()); have == nil || have.Hash() != block.Hash() {
+			t.Errorf("block %d: canonical block mismatch", block.NumberU64())
+		}
+		if receipts := chain.GetReceiptsByHash(block.Hash()); len(receipts) != 1 {
+			t.Errorf("block %d: receipts missing", block.NumberU64())
+		}
+		if tx, _, _, _ := chain.GetTransaction(block.Transactions()[0].Hash()); tx == nil {
+			t.Errorf("block %d: transaction missing", block.NumberU64())
+		}
+	}
+}
+
+func TestGetHashFn(t *testing.T) {
+	key, _ := crypto.GenerateKey()
+	chain, err := NewBlockChain(rawdb.NewMemoryDatabase(), newTestGenesis(crypto.PubkeyToAddress(key.PublicKey)), vm.Config{})
+	if err != nil {
+		t.Fatalf("failed to create chain: %v", err)
+	}
+	hashes := []common.Hash{chain.Genesis().Hash()}
+	for i := uint64(0); i < 3; i++ {
+		block := newChainBlock(t, chain, key, i)
+		if err := chain.InsertBlock(block); err != nil {
+			t.Fatalf("block %d: failed to insert: %v", block.NumberU64(), err)
+		}
+		hashes = append(hashes, block.Hash())
+	}
+	// Ancestors are found walking back from the parent of the reference.
+	ref := &types.Header{Number: big.NewInt(4), ParentHash: hashes[3]}
+	getHash := GetHashFn(ref, chain)
+	for n := len(hashes) - 1; n >= 0; n-- {
+		if have := getHash(uint64(n)); have != hashes[n] {
+			t.Errorf("block %d: hash mismatch: have %x, want %x", n, have, hashes[n])
+		}
+	}
+	if have := getHash(4); have != (common.Hash{}) {
+		t.Errorf("hash of the reference block served: %x", have)
+	}
+	// Without a chain only the parent is known.
+	getHash = GetHashFn(ref, nil)
+	if have := getHash(3); have != hashes[3] {
+		t.Errorf("parent hash mismatch: have %x, want %x", have, hashes[3])
+	}
+	if have := getHash(2); have != (common.Hash{}) {
+		t.Errorf("ancestor served without a chain: %x", have)
+	}
+}
@@ -19,15 +19,15 @@ package rawdb
 import (
 	"bytes"
 	"errors"
+	"ethereum-evm/ethdb"
+	"ethereum-evm/ethdb/leveldb"
+	"ethereum-evm/ethdb/memorydb"
 	"fmt"
 	"os"
 	"sync/atomic"
 	"time"
 
 	"github.com/ethereum/go-ethereum/common"
-	"github.com/ethereum/go-ethereum/ethdb"
-	"github.com/ethereum/go-ethereum/ethdb/leveldb"
-	"github.com/ethereum/go-ethereum/ethdb/memorydb"
 	"github.com/ethereum/go-ethereum/log"
 	"github.com/olekukonko/tablewriter"
 )
@@ -18,6 +18,7 @@ package rawdb
 
 import (
 	"errors"
+	"ethereum-evm/ethdb"
 	"fmt"
 	"math"
 	"os"
@@ -27,7 +28,6 @@ import (
 	"time"
 
 	"github.com/ethereum/go-ethereum/common"
-	"github.com/ethereum/go-ethereum/ethdb"
 	"github.com/ethereum/go-ethereum/log"
 	"github.com/ethereum/go-ethereum/metrics"
 	"github.com/ethereum/go-ethereum/params"
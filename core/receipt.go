@@ -0,0 +1,28 @@
+package core
+
+import (
+	"ethereum-evm/core/state"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core/types"
+)
+
+// NewReceipt creates the receipt of a message executed on statedb. The logs
+// emitted under txHash (see StateDB.Prepare) are attached to the receipt and
+// its bloom filter is derived from them.
+func NewReceipt(statedb *state.StateDB, txHash common.Hash, failed bool, gasUsed, cumulativeGasUsed uint64) *types.Receipt {
+	receipt := &types.Receipt{Type: types.LegacyTxType, CumulativeGasUsed: cumulativeGasUsed}
+	if failed {
+		receipt.Status = types.ReceiptStatusFailed
+	} else {
+		receipt.Status = types.ReceiptStatusSuccessful
+	}
+	receipt.TxHash = txHash
+	receipt.GasUsed = gasUsed
+
+	// Set the receipt logs and create the bloom filter.
+	receipt.Logs = statedb.GetLogs(txHash, common.Hash{})
+	receipt.Bloom = types.CreateBloom(types.Receipts{receipt})
+	receipt.TransactionIndex = uint(statedb.TxIndex())
+	return receipt
+}
@@ -0,0 +1,54 @@
+package core
+
+import (
+	"ethereum-evm/core/state"
+	"ethereum-evm/ethdb/memorydb"
+	"testing"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core/types"
+)
+
+func TestNewReceipt(t *testing.T) {
+	var (
+		statedb, _ = state.New(types.EmptyRootHash, state.NewDatabase(memorydb.New()))
+		emitter    = common.HexToAddress("0xe0")
+		topic      = common.HexToHash("0x01")
+		first      = common.HexToHash("0xaa")
+		second     = common.HexToHash("0xbb")
+	)
+	statedb.Prepare(first, 0)
+	statedb.AddLog(&types.Log{Address: emitter})
+	statedb.Prepare(second, 1)
+	statedb.AddLog(&types.Log{Address: emitter, Topics: []common.Hash{topic}})
+	statedb.AddLog(&types.Log{Address: emitter, Data: []byte{0x01}})
+
+	receipt := NewReceipt(statedb, second, false, 30000, 51000)
+	if receipt.Status != types.ReceiptStatusSuccessful {
+		t.Errorf("status mismatch: have %d, want %d", receipt.Status, types.ReceiptStatusSuccessful)
+	}
+	if receipt.TxHash != second || receipt.TransactionIndex != 1 {
+		t.Errorf("transaction mismatch: have %x at %d", receipt.TxHash, receipt.TransactionIndex)
+	}
+	if receipt.GasUsed != 30000 || receipt.CumulativeGasUsed != 51000 {
+		t.Errorf("gas mismatch: have %d used, %d cumulative", receipt.GasUsed, receipt.CumulativeGasUsed)
+	}
+	// Only the logs of the transaction are attached, keeping their block index.
+	if len(receipt.Logs) != 2 {
+		t.Fatalf("log count mismatch: have %d, want 2", len(receipt.Logs))
+	}
+	for i, log := range receipt.Logs {
+		if log.TxHash != second || log.TxIndex != 1 || log.Index != uint(i+1) {
+			t.Errorf("log %d mismatch: %+v", i, log)
+		}
+	}
+	if !types.BloomLookup(receipt.Bloom, emitter) || !types.BloomLookup(receipt.Bloom, topic) {
+		t.Errorf("bloom misses the logs")
+	}
+	if types.BloomLookup(receipt.Bloom, common.HexToHash("0x02")) {
+		t.Errorf("bloom matches an unrelated topic")
+	}
+	if receipt := NewReceipt(statedb, first, true, 21000, 21000); receipt.Status != types.ReceiptStatusFailed {
+		t.Errorf("failed status mismatch: have %d, want %d", receipt.Status, types.ReceiptStatusFailed)
+	}
+}
@@ -0,0 +1,82 @@
+package state
+
+import (
+	"ethereum-evm/common/hexutil"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/crypto"
+)
+
+// AccountResult is an account together with its Merkle proof, in the shape
+// returned by eth_getProof.
+type AccountResult struct {
+	Address      common.Address  `json:"address"`
+	AccountProof []string        `json:"accountProof"`
+	Balance      *hexutil.Big    `json:"balance"`
+	CodeHash     common.Hash     `json:"codeHash"`
+	Nonce        hexutil.Uint64  `json:"nonce"`
+	StorageHash  common.Hash     `json:"storageHash"`
+	StorageProof []StorageResult `json:"storageProof"`
+}
+
+// StorageResult is a storage slot together with its Merkle proof against the
+// storage root of the owning account.
+type StorageResult struct {
+	Key   string       `json:"key"`
+	Value *hexutil.Big `json:"value"`
+	Proof []string     `json:"proof"`
+}
+
+// GetAccountProof returns the Merkle proof of the given account and of the given
+// storage slots of that account. Proofs are made against the tries as they were
+// last hashed, so pending changes must be flushed with IntermediateRoot or Commit
+// first.
+func (s *StateDB) GetAccountProof(addr common.Address, storageKeys []common.Hash) (*AccountResult, error) {
+	var (
+		storageTrie  = s.StorageTrie(addr)
+		storageHash  = types.EmptyRootHash
+		codeHash     = s.GetCodeHash(addr)
+		storageProof = make([]StorageResult, len(storageKeys))
+	)
+	// If we have a storage trie the account exists, otherwise the code hash
+	// is the hash of an empty byte array.
+	if storageTrie != nil {
+		storageHash = storageTrie.Hash()
+	} else {
+		codeHash = crypto.Keccak256Hash(nil)
+	}
+	for i, key := range storageKeys {
+		if storageTrie == nil {
+			storageProof[i] = StorageResult{key.Hex(), &hexutil.Big{}, []string{}}
+			continue
+		}
+		proof, err := s.GetStorageProof(addr, key)
+		if err != nil {
+			return nil, err
+		}
+		storageProof[i] = StorageResult{key.Hex(), (*hexutil.Big)(s.GetState(addr, key).Big()), toHexSlice(proof)}
+	}
+	accountProof, err := s.GetProof(addr)
+	if err != nil {
+		return nil, err
+	}
+	return &AccountResult{
+		Address:      addr,
+		AccountProof: toHexSlice(accountProof),
+		Balance:      (*hexutil.Big)(s.GetBalance(addr)),
+		CodeHash:     codeHash,
+		Nonce:        hexutil.Uint64(s.GetNonce(addr)),
+		StorageHash:  storageHash,
+		StorageProof: storageProof,
+	}, s.Error()
+}
+
+// toHexSlice creates a slice of hex-strings based on []byte.
+func toHexSlice(b [][]byte) []string {
+	r := make([]string, len(b))
+	for i := range b {
+		r[i] = hexutil.Encode(b[i])
+	}
+	return r
+}
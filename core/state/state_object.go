@@ -19,7 +19,6 @@ package state
 import (
 	"bytes"
 	"encoding/hex"
-	"ethereum-evm/ethdb/leveldb"
 	"fmt"
 	"io"
 	"math/big"
@@ -76,7 +75,7 @@ type stateObject struct {
 	dbErr error
 
 	// Write caches.
-	// trie Trie // storage trie, which becomes non-nil on first access
+	trie Trie // storage trie, which becomes non-nil on first access
 	code Code // contract bytecode, which gets set when code is loaded
 
 	originStorage  Storage // Storage cache of original entries to dedup rewrites, reset for every transaction
@@ -106,11 +105,6 @@ type Account struct {
 	CodeHash []byte
 }
 
-type ContractAccountState struct {
-	Address common.Address
-	Key     common.Hash
-}
-
 // newObject creates a state object.
 func newObject(db *StateDB, address common.Address, data Account) *stateObject {
 	if data.Balance == nil {
@@ -150,137 +144,88 @@ func (s *stateObject) markSuicided() {
 	s.suicided = true
 }
 
-// // func (s *stateObject) touch() {
-// // 	s.db.journal.append(touchChange{
-// // 		account: &s.address,
-// // 	})
-// // 	if s.address == ripemd {
-// // 		// Explicitly put it in the dirty-cache, which is otherwise generated from
-// // 		// flattened journals.
-// // 		s.db.journal.dirty(s.address)
-// // 	}
-// // }
+func (s *stateObject) touch() {
+	s.db.journal.append(touchChange{
+		account: &s.address,
+	})
+	if s.address == ripemd {
+		// Explicitly put it in the dirty-cache, which is otherwise generated from
+		// flattened journals.
+		s.db.journal.dirty(s.address)
+	}
+}
+
+func (s *stateObject) getTrie(db Database) Trie {
+	if s.trie == nil {
+		var err error
+		s.trie, err = db.OpenStorageTrie(s.addrHash, s.data.Root)
+		if err != nil {
+			s.trie, _ = db.OpenStorageTrie(s.addrHash, common.Hash{})
+			s.setError(fmt.Errorf("can't create storage trie: %v", err))
+		}
+	}
+	return s.trie
+}
 
 // GetState retrieves a value from the account storage trie.
-func (s *stateObject) GetState(db leveldb.Database, key common.Hash) common.Hash {
+func (s *stateObject) GetState(db Database, key common.Hash) common.Hash {
 	// If the fake storage is set, only lookup the state here(in the debugging mode)
 	// if s.fakeStorage != nil {
 	// 	return s.fakeStorage[key]
 	// }
-	// // If we have a dirty value for this state entry, return it
-	// value, dirty := s.dirtyStorage[key]
-	// if dirty {
-	// 	return value
-	// }
-	// // Otherwise return the entry's original value
-	// return s.GetCommittedState(db, key)
-
-	cas := ContractAccountState{s.Address(), key}
-	fmt.Println("############GetState==========>", cas)
-	enValue, _ := rlp.EncodeToBytes(cas)
-	fmt.Println("############GetState==========enValue>", enValue)
-	value, err := db.Get(enValue)
+	// If we have a dirty value for this state entry, return it
+	value, dirty := s.dirtyStorage[key]
+	if dirty {
+		return value
+	}
+	// Otherwise return the entry's original value
+	return s.GetCommittedState(db, key)
+}
+
+// GetCommittedState retrieves a value from the committed account storage trie.
+func (s *stateObject) GetCommittedState(db Database, key common.Hash) common.Hash {
+	// If we have a pending write or clean cached, return that
+	if value, pending := s.pendingStorage[key]; pending {
+		return value
+	}
+	if value, cached := s.originStorage[key]; cached {
+		return value
+	}
+	enc, err := s.getTrie(db).TryGet(key.Bytes())
 	if err != nil {
+		s.setError(err)
 		return common.Hash{}
 	}
-	fmt.Printf("############GetState==========value=> %s\n", value)
-	var hash common.Hash
-	copy(hash[:], value[:])
-	return hash
-
-}
-
-// // GetCommittedState retrieves a value from the committed account storage trie.
-// // func (s *stateObject) GetCommittedState(db Database, key common.Hash) common.Hash {
-// // 	// If the fake storage is set, only lookup the state here(in the debugging mode)
-// // 	if s.fakeStorage != nil {
-// // 		return s.fakeStorage[key]
-// // 	}
-// // 	// If we have a pending write or clean cached, return that
-// // 	if value, pending := s.pendingStorage[key]; pending {
-// // 		return value
-// // 	}
-// // 	if value, cached := s.originStorage[key]; cached {
-// // 		return value
-// // 	}
-// // 	// If no live objects are available, attempt to use snapshots
-// // 	var (
-// // 		enc   []byte
-// // 		err   error
-// // 		meter *time.Duration
-// // 	)
-// // 	readStart := time.Now()
-// // 	if metrics.EnabledExpensive {
-// // 		// If the snap is 'under construction', the first lookup may fail. If that
-// // 		// happens, we don't want to double-count the time elapsed. Thus this
-// // 		// dance with the metering.
-// // 		defer func() {
-// // 			if meter != nil {
-// // 				*meter += time.Since(readStart)
-// // 			}
-// // 		}()
-// // 	}
-// // 	if s.db.snap != nil {
-// // 		if metrics.EnabledExpensive {
-// // 			meter = &s.db.SnapshotStorageReads
-// // 		}
-// // 		// If the object was destructed in *this* block (and potentially resurrected),
-// // 		// the storage has been cleared out, and we should *not* consult the previous
-// // 		// snapshot about any storage values. The only possible alternatives are:
-// // 		//   1) resurrect happened, and new slot values were set -- those should
-// // 		//      have been handles via pendingStorage above.
-// // 		//   2) we don't have new values, and can deliver empty response back
-// // 		if _, destructed := s.db.snapDestructs[s.addrHash]; destructed {
-// // 			return common.Hash{}
-// // 		}
-// // 		enc, err = s.db.snap.Storage(s.addrHash, crypto.Keccak256Hash(key.Bytes()))
-// // 	}
-// // 	// If snapshot unavailable or reading from it failed, load from the database
-// // 	if s.db.snap == nil || err != nil {
-// // 		if meter != nil {
-// // 			// If we already spent time checking the snapshot, account for it
-// // 			// and reset the readStart
-// // 			*meter += time.Since(readStart)
-// // 			readStart = time.Now()
-// // 		}
-// // 		if metrics.EnabledExpensive {
-// // 			meter = &s.db.StorageReads
-// // 		}
-// // 		if enc, err = s.getTrie(db).TryGet(key.Bytes()); err != nil {
-// // 			s.setError(err)
-// // 			return common.Hash{}
-// // 		}
-// // 	}
-// // 	var value common.Hash
-// // 	if len(enc) > 0 {
-// // 		_, content, _, err := rlp.Split(enc)
-// // 		if err != nil {
-// // 			s.setError(err)
-// // 		}
-// // 		value.SetBytes(content)
-// // 	}
-// // 	s.originStorage[key] = value
-// // 	return value
-// // }
+	var value common.Hash
+	if len(enc) > 0 {
+		_, content, _, err := rlp.Split(enc)
+		if err != nil {
+			s.setError(err)
+		}
+		value.SetBytes(content)
+	}
+	s.originStorage[key] = value
+	return value
+}
 
 // SetState updates a value in account storage.
-func (s *stateObject) SetState(db leveldb.Database, key, value common.Hash) {
+func (s *stateObject) SetState(db Database, key, value common.Hash) {
 	// // If the fake storage is set, put the temporary state update here.
 	// if s.fakeStorage != nil {
 	// 	s.fakeStorage[key] = value
 	// 	return
 	// }
-	// // If the new value is the same as old, don't set
-	// prev := s.GetState(db, key)
-	// if prev == value {
-	// 	return
-	// }
-	// // New value is different, update and journal the change
-	// s.db.journal.append(storageChange{
-	// 	account:  &s.address,
-	// 	key:      key,
-	// 	prevalue: prev,
-	// })
+	// If the new value is the same as old, don't set
+	prev := s.GetState(db, key)
+	if prev == value {
+		return
+	}
+	// New value is different, update and journal the change
+	s.db.journal.append(storageChange{
+		account:  &s.address,
+		key:      key,
+		prevalue: prev,
+	})
 	s.setState(key, value)
 }
 
@@ -304,172 +249,125 @@ func (s *stateObject) SetState(db leveldb.Database, key, value common.Hash) {
 
 func (s *stateObject) setState(key, value common.Hash) {
 	s.dirtyStorage[key] = value
-
-	cas := ContractAccountState{s.Address(), key}
-	// fmt.Println("############setState==========>", cas)
-	enValue, _ := rlp.EncodeToBytes(cas)
-	// fmt.Println("############setState==========enValue>", enValue)
-	s.db.db.Put(enValue, value.Bytes())
 }
 
 // finalise moves all dirty storage slots into the pending area to be hashed or
 // committed later. It is invoked at the end of every transaction.
-// func (s *stateObject) finalise(prefetch bool) {
-// 	slotsToPrefetch := make([][]byte, 0, len(s.dirtyStorage))
-// 	for key, value := range s.dirtyStorage {
-// 		s.pendingStorage[key] = value
-// 		if value != s.originStorage[key] {
-// 			slotsToPrefetch = append(slotsToPrefetch, common.CopyBytes(key[:])) // Copy needed for closure
-// 		}
-// 	}
-// 	if s.db.prefetcher != nil && prefetch && len(slotsToPrefetch) > 0 && s.data.Root != emptyRoot {
-// 		s.db.prefetcher.prefetch(s.data.Root, slotsToPrefetch)
-// 	}
-// 	if len(s.dirtyStorage) > 0 {
-// 		s.dirtyStorage = make(Storage)
-// 	}
-// }
+func (s *stateObject) finalise() {
+	for key, value := range s.dirtyStorage {
+		s.pendingStorage[key] = value
+	}
+	if len(s.dirtyStorage) > 0 {
+		s.dirtyStorage = make(Storage)
+	}
+}
 
 // updateTrie writes cached storage modifications into the object's storage trie.
 // It will return nil if the trie has not been loaded and no changes have been made
-// func (s *stateObject) updateTrie(db Database) Trie {
-// 	// Make sure all dirty slots are finalized into the pending storage area
-// 	s.finalise(false) // Don't prefetch any more, pull directly if need be
-// 	if len(s.pendingStorage) == 0 {
-// 		return s.trie
-// 	}
-// 	// Track the amount of time wasted on updating the storage trie
-// 	if metrics.EnabledExpensive {
-// 		defer func(start time.Time) { s.db.StorageUpdates += time.Since(start) }(time.Now())
-// 	}
-// 	// The snapshot storage map for the object
-// 	var storage map[common.Hash][]byte
-// 	// Insert all the pending updates into the trie
-// 	tr := s.getTrie(db)
-// 	hasher := s.db.hasher
-
-// 	usedStorage := make([][]byte, 0, len(s.pendingStorage))
-// 	for key, value := range s.pendingStorage {
-// 		// Skip noop changes, persist actual changes
-// 		if value == s.originStorage[key] {
-// 			continue
-// 		}
-// 		s.originStorage[key] = value
-
-// 		var v []byte
-// 		if (value == common.Hash{}) {
-// 			s.setError(tr.TryDelete(key[:]))
-// 		} else {
-// 			// Encoding []byte cannot fail, ok to ignore the error.
-// 			v, _ = rlp.EncodeToBytes(common.TrimLeftZeroes(value[:]))
-// 			s.setError(tr.TryUpdate(key[:], v))
-// 		}
-// 		// If state snapshotting is active, cache the data til commit
-// 		if s.db.snap != nil {
-// 			if storage == nil {
-// 				// Retrieve the old storage map, if available, create a new one otherwise
-// 				if storage = s.db.snapStorage[s.addrHash]; storage == nil {
-// 					storage = make(map[common.Hash][]byte)
-// 					s.db.snapStorage[s.addrHash] = storage
-// 				}
-// 			}
-// 			storage[crypto.HashData(hasher, key[:])] = v // v will be nil if value is 0x00
-// 		}
-// 		usedStorage = append(usedStorage, common.CopyBytes(key[:])) // Copy needed for closure
-// 	}
-// 	if s.db.prefetcher != nil {
-// 		s.db.prefetcher.used(s.data.Root, usedStorage)
-// 	}
-// 	if len(s.pendingStorage) > 0 {
-// 		s.pendingStorage = make(Storage)
-// 	}
-// 	return tr
-// }
+func (s *stateObject) updateTrie(db Database) Trie {
+	// Make sure all dirty slots are finalized into the pending storage area
+	s.finalise()
+	if len(s.pendingStorage) == 0 {
+		return s.trie
+	}
+	// Insert all the pending updates into the trie
+	tr := s.getTrie(db)
+	for key, value := range s.pendingStorage {
+		// Skip noop changes, persist actual changes
+		if value == s.originStorage[key] {
+			continue
+		}
+		s.originStorage[key] = value
+
+		if (value == common.Hash{}) {
+			s.setError(tr.TryDelete(key[:]))
+		} else {
+			// Encoding []byte cannot fail, ok to ignore the error.
+			v, _ := rlp.EncodeToBytes(common.TrimLeftZeroes(value[:]))
+			s.setError(tr.TryUpdate(key[:], v))
+		}
+	}
+	if len(s.pendingStorage) > 0 {
+		s.pendingStorage = make(Storage)
+	}
+	return tr
+}
 
 // UpdateRoot sets the trie root to the current root hash of
-// func (s *stateObject) updateRoot(db Database) {
-// 	// If nothing changed, don't bother with hashing anything
-// 	if s.updateTrie(db) == nil {
-// 		return
-// 	}
-// 	// Track the amount of time wasted on hashing the storage trie
-// 	if metrics.EnabledExpensive {
-// 		defer func(start time.Time) { s.db.StorageHashes += time.Since(start) }(time.Now())
-// 	}
-// 	s.data.Root = s.trie.Hash()
-// }
+func (s *stateObject) updateRoot(db Database) {
+	// If nothing changed, don't bother with hashing anything
+	if s.updateTrie(db) == nil {
+		return
+	}
+	s.data.Root = s.trie.Hash()
+}
 
 // CommitTrie the storage trie of the object to db.
 // This updates the trie root.
-// func (s *stateObject) CommitTrie(db Database) error {
-// 	// If nothing changed, don't bother with hashing anything
-// 	if s.updateTrie(db) == nil {
-// 		return nil
-// 	}
-// 	if s.dbErr != nil {
-// 		return s.dbErr
-// 	}
-// 	// Track the amount of time wasted on committing the storage trie
-// 	if metrics.EnabledExpensive {
-// 		defer func(start time.Time) { s.db.StorageCommits += time.Since(start) }(time.Now())
-// 	}
-// 	root, err := s.trie.Commit(nil)
-// 	if err == nil {
-// 		s.data.Root = root
-// 	}
-// 	return err
-// }
+func (s *stateObject) CommitTrie(db Database) error {
+	// If nothing changed, don't bother with hashing anything
+	if s.updateTrie(db) == nil {
+		return nil
+	}
+	if s.dbErr != nil {
+		return s.dbErr
+	}
+	root, err := s.trie.Commit(nil)
+	if err == nil {
+		s.data.Root = root
+	}
+	return err
+}
 
-// // AddBalance adds amount to s's balance.
-// // It is used to add funds to the destination account of a transfer.
-// func (s *stateObject) AddBalance(amount *big.Int) {
-// 	// EIP161: We must check emptiness for the objects such that the account
-// 	// clearing (0,0,0 objects) can take effect.
-// 	if amount.Sign() == 0 {
-// 		if s.empty() {
-// 			s.touch()
-// 		}
-// 		return
-// 	}
-// 	s.SetBalance(new(big.Int).Add(s.Balance(), amount))
-// }
+// AddBalance adds amount to s's balance.
+// It is used to add funds to the destination account of a transfer.
+func (s *stateObject) AddBalance(amount *big.Int) {
+	// EIP161: We must check emptiness for the objects such that the account
+	// clearing (0,0,0 objects) can take effect.
+	if amount.Sign() == 0 {
+		if s.empty() {
+			s.touch()
+		}
+		return
+	}
+	s.SetBalance(new(big.Int).Add(s.Balance(), amount))
+}
 
-// // SubBalance removes amount from s's balance.
-// // It is used to remove funds from the origin account of a transfer.
-// func (s *stateObject) SubBalance(amount *big.Int) {
-// 	if amount.Sign() == 0 {
-// 		return
-// 	}
-// 	s.SetBalance(new(big.Int).Sub(s.Balance(), amount))
-// }
+// SubBalance removes amount from s's balance.
+// It is used to remove funds from the origin account of a transfer.
+func (s *stateObject) SubBalance(amount *big.Int) {
+	if amount.Sign() == 0 {
+		return
+	}
+	s.SetBalance(new(big.Int).Sub(s.Balance(), amount))
+}
 
 func (s *stateObject) SetBalance(amount *big.Int) {
-	// s.db.journal.append(balanceChange{
-	// 	account: &s.address,
-	// 	prev:    new(big.Int).Set(s.data.Balance),
-	// })
+	s.db.journal.append(balanceChange{
+		account: &s.address,
+		prev:    new(big.Int).Set(s.data.Balance),
+	})
 	s.setBalance(amount)
 }
 
 func (s *stateObject) setBalance(amount *big.Int) {
 	s.data.Balance = amount
-	s.setAccount()
 }
 
-// func (s *stateObject) deepCopy(db *StateDB) *stateObject {
-// 	stateObject := newObject(db, s.address, s.data)
-// 	if s.trie != nil {
-// 		stateObject.trie = db.db.CopyTrie(s.trie)
-// 	}
-// 	stateObject.code = s.code
-// 	stateObject.dirtyStorage = s.dirtyStorage.Copy()
-// 	stateObject.originStorage = s.originStorage.Copy()
-// 	stateObject.pendingStorage = s.pendingStorage.Copy()
-// 	stateObject.suicided = s.suicided
-// 	stateObject.dirtyCode = s.dirtyCode
-// 	stateObject.deleted = s.deleted
-// 	return stateObject
-// }
+func (s *stateObject) deepCopy(db *StateDB) *stateObject {
+	stateObject := newObject(db, s.address, s.data)
+	if s.trie != nil {
+		stateObject.trie = db.db.CopyTrie(s.trie)
+	}
+	stateObject.code = s.code
+	stateObject.dirtyStorage = s.dirtyStorage.Copy()
+	stateObject.originStorage = s.originStorage.Copy()
+	stateObject.pendingStorage = s.pendingStorage.Copy()
+	stateObject.suicided = s.suicided
+	stateObject.dirtyCode = s.dirtyCode
+	stateObject.deleted = s.deleted
+	return stateObject
+}
 
 //
 // Attribute accessors
@@ -481,7 +379,7 @@ func (s *stateObject) Address() common.Address {
 }
 
 // Code returns the contract code associated with this object, if any.
-func (s *stateObject) Code(db leveldb.Database) []byte {
+func (s *stateObject) Code(db Database) []byte {
 	if s.code != nil {
 		return s.code
 	}
@@ -489,8 +387,7 @@ func (s *stateObject) Code(db leveldb.Database) []byte {
 		return nil
 	}
 
-	code, err := db.Get(s.data.CodeHash)
-	// code, err := db.ContractCode(s.addrHash, common.BytesToHash(s.CodeHash()))
+	code, err := db.ContractCode(s.addrHash, common.BytesToHash(s.CodeHash()))
 	if err != nil {
 		s.setError(fmt.Errorf("can't load code hash %x: %v", s.CodeHash(), err))
 	}
@@ -501,28 +398,27 @@ func (s *stateObject) Code(db leveldb.Database) []byte {
 // CodeSize returns the size of the contract code associated with this object,
 // or zero if none. This method is an almost mirror of Code, but uses a cache
 // inside the database to avoid loading codes seen recently.
-func (s *stateObject) CodeSize(db leveldb.Database) int {
+func (s *stateObject) CodeSize(db Database) int {
 	if s.code != nil {
 		return len(s.code)
 	}
 	if bytes.Equal(s.CodeHash(), emptyCodeHash) {
 		return 0
 	}
-	// size, err := db.ContractCodeSize(s.addrHash, common.BytesToHash(s.CodeHash()))
-	// if err != nil {
-	// 	s.setError(fmt.Errorf("can't load code size %x: %v", s.CodeHash(), err))
-	// }
-	// return size
-	return 0
+	size, err := db.ContractCodeSize(s.addrHash, common.BytesToHash(s.CodeHash()))
+	if err != nil {
+		s.setError(fmt.Errorf("can't load code size %x: %v", s.CodeHash(), err))
+	}
+	return size
 }
 
 func (s *stateObject) SetCode(codeHash common.Hash, code []byte) {
-	// prevcode := s.Code(s.db.db)
-	// s.db.journal.append(codeChange{
-	// 	account:  &s.address,
-	// 	prevhash: s.CodeHash(),
-	// 	prevcode: prevcode,
-	// })
+	prevcode := s.Code(s.db.db)
+	s.db.journal.append(codeChange{
+		account:  &s.address,
+		prevhash: s.CodeHash(),
+		prevcode: prevcode,
+	})
 	s.setCode(codeHash, code)
 }
 
@@ -530,26 +426,18 @@ func (s *stateObject) setCode(codeHash common.Hash, code []byte) {
 	s.code = code
 	s.data.CodeHash = codeHash[:]
 	s.dirtyCode = true
-	s.setAccount()
-	s.db.db.Put(s.data.CodeHash, code)
 }
 
 func (s *stateObject) SetNonce(nonce uint64) {
-	// s.db.journal.append(nonceChange{
-	// 	account: &s.address,
-	// 	prev:    s.data.Nonce,
-	// })
+	s.db.journal.append(nonceChange{
+		account: &s.address,
+		prev:    s.data.Nonce,
+	})
 	s.setNonce(nonce)
 }
 
 func (s *stateObject) setNonce(nonce uint64) {
 	s.data.Nonce = nonce
-	s.setAccount()
-	// enValue, _ := rlp.EncodeToBytes(s.data)
-
-	// fmt.Println("@@@setNonce=>s.Address():", s.Address())
-	// fmt.Println("@@@setNonce=>enValue:", enValue)
-	// s.db.db.Put(s.Address().Bytes(), enValue)
 }
 
 func (s *stateObject) CodeHash() []byte {
@@ -571,11 +459,6 @@ func (s *stateObject) Value() *big.Int {
 	panic("Value on stateObject should never be called")
 }
 
-func (s *stateObject) setAccount() {
-	enValue, _ := rlp.EncodeToBytes(s.data)
-	s.db.db.Put(s.Address().Bytes(), enValue)
-}
-
 func (s *stateObject) printAccount() {
 	// str := fmt.Sprintf("### %s ###", s.Address())
 	fmt.Printf("######## %s #######\n", s.Address())
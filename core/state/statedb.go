@@ -18,9 +18,11 @@
 package state
 
 import (
-	"ethereum-evm/ethdb/leveldb"
+	"errors"
+	"ethereum-evm/trie"
 	"fmt"
 	"math/big"
+	"sort"
 
 	"github.com/cloudflare/cfssl/log"
 	"github.com/ethereum/go-ethereum/common"
@@ -39,29 +41,17 @@ var (
 	emptyRoot = common.HexToHash("56e81f171bcc55a6ff8345e692c0f86e5b48e01b996cadc001622fb5e363b421")
 )
 
-type proofList [][]byte
-
-func (n *proofList) Put(key []byte, value []byte) error {
-	*n = append(*n, value)
-	return nil
-}
-
-func (n *proofList) Delete(key []byte) error {
-	panic("not supported")
-}
-
 // StateDB structs within the ethereum protocol are used to store anything
 // within the merkle trie. StateDBs take care of caching and storing
 // nested states. It's the general query interface to retrieve:
 // * Contracts
 // * Accounts
 type StateDB struct {
-	db leveldb.Database
-	// db           Database
+	db Database
 	// prefetcher   *triePrefetcher
 	originalRoot common.Hash // The pre-state root, before any changes were made
-	// trie         Trie
-	hasher crypto.KeccakState
+	trie         Trie
+	hasher       crypto.KeccakState
 
 	// snaps         *snapshot.Tree
 	// snap          snapshot.Snapshot
@@ -96,7 +86,7 @@ type StateDB struct {
 
 	// Journal of state modifications. This is the backbone of
 	// Snapshot and RevertToSnapshot.
-	// journal        *journal
+	journal        *journal
 	validRevisions []revision
 	nextRevisionId int
 
@@ -115,55 +105,24 @@ type StateDB struct {
 }
 
 // New creates a new state from a given trie.
-// func New(root common.Hash, db Database, snaps *snapshot.Tree) (*StateDB, error) {
-// 	tr, err := db.OpenTrie(root)
-// 	if err != nil {
-// 		return nil, err
-// 	}
-// 	sdb := &StateDB{
-// 		db:                  db,
-// 		trie:                tr,
-// 		originalRoot:        root,
-// 		snaps:               snaps,
-// 		stateObjects:        make(map[common.Address]*stateObject),
-// 		stateObjectsPending: make(map[common.Address]struct{}),
-// 		stateObjectsDirty:   make(map[common.Address]struct{}),
-// 		logs:                make(map[common.Hash][]*types.Log),
-// 		preimages:           make(map[common.Hash][]byte),
-// 		journal:             newJournal(),
-// 		accessList:          newAccessList(),
-// 		hasher:              crypto.NewKeccakState(),
-// 	}
-// 	if sdb.snaps != nil {
-// 		if sdb.snap = sdb.snaps.Snapshot(root); sdb.snap != nil {
-// 			sdb.snapDestructs = make(map[common.Hash]struct{})
-// 			sdb.snapAccounts = make(map[common.Hash][]byte)
-// 			sdb.snapStorage = make(map[common.Hash]map[common.Hash][]byte)
-// 		}
-// 	}
-// 	return sdb, nil
-// }
-func New(root common.Hash) (*StateDB, error) {
-	// file string, cache int, handles int, namespace string, readonly bool
-	db, err := leveldb.New("/Users/jc/Documents/project/github/ethereum-evm/db", 0, 0, "", false)
+func New(root common.Hash, db Database) (*StateDB, error) {
+	tr, err := db.OpenTrie(root)
 	if err != nil {
 		return nil, err
 	}
 	sdb := &StateDB{
-		db: *db,
-		// trie:                tr,
-		originalRoot: root,
-		// snaps:               snaps,
+		db:                  db,
+		trie:                tr,
+		originalRoot:        root,
 		stateObjects:        make(map[common.Address]*stateObject),
 		stateObjectsPending: make(map[common.Address]struct{}),
 		stateObjectsDirty:   make(map[common.Address]struct{}),
 		logs:                make(map[common.Hash][]*types.Log),
 		preimages:           make(map[common.Hash][]byte),
-		// journal:             newJournal(),
-		// accessList:          newAccessList(),
-		// hasher:              crypto.NewKeccakState(),
+		journal:             newJournal(),
+		accessList:          newAccessList(),
+		hasher:              crypto.NewKeccakState(),
 	}
-
 	return sdb, nil
 }
 
@@ -189,51 +148,61 @@ func New(root common.Hash) (*StateDB, error) {
 // 	}
 // }
 
-// // setError remembers the first non-nil error it is called with.
-// func (s *StateDB) setError(err error) {
-// 	if s.dbErr == nil {
-// 		s.dbErr = err
-// 	}
-// }
+// setError remembers the first non-nil error it is called with.
+func (s *StateDB) setError(err error) {
+	if s.dbErr == nil {
+		s.dbErr = err
+	}
+}
 
-// func (s *StateDB) Error() error {
-// 	return s.dbErr
-// }
+func (s *StateDB) Error() error {
+	return s.dbErr
+}
 
 func (s *StateDB) AddLog(log *types.Log) {
-	// s.journal.append(addLogChange{txhash: s.thash})
+	s.journal.append(addLogChange{txhash: s.thash})
 
-	// log.TxHash = s.thash
-	// log.TxIndex = uint(s.txIndex)
-	// log.Index = s.logSize
-	// s.logs[s.thash] = append(s.logs[s.thash], log)
-	// s.logSize++
+	log.TxHash = s.thash
+	log.TxIndex = uint(s.txIndex)
+	log.Index = s.logSize
+	s.logs[s.thash] = append(s.logs[s.thash], log)
+	s.logSize++
 }
 
-// func (s *StateDB) GetLogs(hash common.Hash, blockHash common.Hash) []*types.Log {
-// 	logs := s.logs[hash]
-// 	for _, l := range logs {
-// 		l.BlockHash = blockHash
-// 	}
-// 	return logs
-// }
+// GetLogs returns the logs emitted by the transaction with the given hash,
+// stamping them with the hash of the block they were included in.
+func (s *StateDB) GetLogs(hash common.Hash, blockHash common.Hash) []*types.Log {
+	logs := s.logs[hash]
+	for _, l := range logs {
+		l.BlockHash = blockHash
+	}
+	return logs
+}
 
-// func (s *StateDB) Logs() []*types.Log {
-// 	var logs []*types.Log
-// 	for _, lgs := range s.logs {
-// 		logs = append(logs, lgs...)
-// 	}
-// 	return logs
-// }
+// Logs returns all logs emitted since the state was created, ordered by the
+// index of their transaction and their position in it.
+func (s *StateDB) Logs() []*types.Log {
+	var logs []*types.Log
+	for _, lgs := range s.logs {
+		logs = append(logs, lgs...)
+	}
+	sort.Slice(logs, func(i, j int) bool {
+		if logs[i].TxIndex != logs[j].TxIndex {
+			return logs[i].TxIndex < logs[j].TxIndex
+		}
+		return logs[i].Index < logs[j].Index
+	})
+	return logs
+}
 
 // AddPreimage records a SHA3 preimage seen by the VM.
 func (s *StateDB) AddPreimage(hash common.Hash, preimage []byte) {
-	// if _, ok := s.preimages[hash]; !ok {
-	// 	s.journal.append(addPreimageChange{hash: hash})
-	// 	pi := make([]byte, len(preimage))
-	// 	copy(pi, preimage)
-	// 	s.preimages[hash] = pi
-	// }
+	if _, ok := s.preimages[hash]; !ok {
+		s.journal.append(addPreimageChange{hash: hash})
+		pi := make([]byte, len(preimage))
+		copy(pi, preimage)
+		s.preimages[hash] = pi
+	}
 }
 
 // Preimages returns a list of SHA3 preimages that have been submitted.
@@ -243,18 +212,18 @@ func (s *StateDB) Preimages() map[common.Hash][]byte {
 
 // AddRefund adds gas to the refund counter
 func (s *StateDB) AddRefund(gas uint64) {
-	// s.journal.append(refundChange{prev: s.refund})
-	// s.refund += gas
+	s.journal.append(refundChange{prev: s.refund})
+	s.refund += gas
 }
 
 // SubRefund removes gas from the refund counter.
 // This method will panic if the refund counter goes below zero
 func (s *StateDB) SubRefund(gas uint64) {
-	// s.journal.append(refundChange{prev: s.refund})
-	// if gas > s.refund {
-	// 	panic(fmt.Sprintf("Refund counter below zero (gas: %d > refund: %d)", gas, s.refund))
-	// }
-	// s.refund -= gas
+	s.journal.append(refundChange{prev: s.refund})
+	if gas > s.refund {
+		panic(fmt.Sprintf("Refund counter below zero (gas: %d > refund: %d)", gas, s.refund))
+	}
+	s.refund -= gas
 }
 
 // Exist reports whether the given account address exists in the state.
@@ -266,34 +235,31 @@ func (s *StateDB) Exist(addr common.Address) bool {
 // Empty returns whether the state object is either non-existent
 // or empty according to the EIP161 specification (balance = nonce = code = 0)
 func (s *StateDB) Empty(addr common.Address) bool {
-	// so := s.getStateObject(addr)
-	// return so == nil || so.empty()
-	return true
+	so := s.getStateObject(addr)
+	return so == nil || so.empty()
 }
 
 // GetBalance retrieves the balance from the given address or 0 if object not found
 func (s *StateDB) GetBalance(addr common.Address) *big.Int {
-	// stateObject := s.getStateObject(addr)
-	// if stateObject != nil {
-	// 	return stateObject.Balance()
-	// }
+	stateObject := s.getStateObject(addr)
+	if stateObject != nil {
+		return stateObject.Balance()
+	}
 	return common.Big0
 }
 
 func (s *StateDB) GetNonce(addr common.Address) uint64 {
 	stateObject := s.getStateObject(addr)
-	fmt.Println("##########GetNonce#########stateObject=>", stateObject)
 	if stateObject != nil {
 		return stateObject.Nonce()
 	}
-	fmt.Println("##########GetNonce#########")
 	return 0
 }
 
-// // TxIndex returns the current transaction index set by Prepare.
-// func (s *StateDB) TxIndex() int {
-// 	return s.txIndex
-// }
+// TxIndex returns the current transaction index set by Prepare.
+func (s *StateDB) TxIndex() int {
+	return s.txIndex
+}
 
 func (s *StateDB) GetCode(addr common.Address) []byte {
 	stateObject := s.getStateObject(addr)
@@ -329,60 +295,60 @@ func (s *StateDB) GetState(addr common.Address, hash common.Hash) common.Hash {
 	return common.Hash{}
 }
 
-// // GetProof returns the Merkle proof for a given account.
-// func (s *StateDB) GetProof(addr common.Address) ([][]byte, error) {
-// 	return s.GetProofByHash(crypto.Keccak256Hash(addr.Bytes()))
-// }
+// GetProof returns the Merkle proof for a given account.
+func (s *StateDB) GetProof(addr common.Address) ([][]byte, error) {
+	return s.GetProofByHash(crypto.Keccak256Hash(addr.Bytes()))
+}
 
-// // GetProofByHash returns the Merkle proof for a given account.
-// func (s *StateDB) GetProofByHash(addrHash common.Hash) ([][]byte, error) {
-// 	var proof proofList
-// 	err := s.trie.Prove(addrHash[:], 0, &proof)
-// 	return proof, err
-// }
+// GetProofByHash returns the Merkle proof for a given account.
+func (s *StateDB) GetProofByHash(addrHash common.Hash) ([][]byte, error) {
+	var proof trie.ProofList
+	err := s.trie.Prove(addrHash[:], 0, &proof)
+	return proof, err
+}
 
-// // GetStorageProof returns the Merkle proof for given storage slot.
-// func (s *StateDB) GetStorageProof(a common.Address, key common.Hash) ([][]byte, error) {
-// 	var proof proofList
-// 	trie := s.StorageTrie(a)
-// 	if trie == nil {
-// 		return proof, errors.New("storage trie for requested address does not exist")
-// 	}
-// 	err := trie.Prove(crypto.Keccak256(key.Bytes()), 0, &proof)
-// 	return proof, err
-// }
+// GetStorageProof returns the Merkle proof for given storage slot.
+func (s *StateDB) GetStorageProof(a common.Address, key common.Hash) ([][]byte, error) {
+	var proof trie.ProofList
+	trie := s.StorageTrie(a)
+	if trie == nil {
+		return proof, errors.New("storage trie for requested address does not exist")
+	}
+	err := trie.Prove(crypto.Keccak256(key.Bytes()), 0, &proof)
+	return proof, err
+}
 
 // GetCommittedState retrieves a value from the given account's committed storage trie.
 func (s *StateDB) GetCommittedState(addr common.Address, hash common.Hash) common.Hash {
-	// stateObject := s.getStateObject(addr)
-	// if stateObject != nil {
-	// 	return stateObject.GetCommittedState(s.db, hash)
-	// }
+	stateObject := s.getStateObject(addr)
+	if stateObject != nil {
+		return stateObject.GetCommittedState(s.db, hash)
+	}
 	return common.Hash{}
 }
 
 // Database retrieves the low level database supporting the lower level trie ops.
-// func (s *StateDB) Database() Database {
-// 	return s.db
-// }
+func (s *StateDB) Database() Database {
+	return s.db
+}
 
-// // StorageTrie returns the storage trie of an account.
-// // The return value is a copy and is nil for non-existent accounts.
-// func (s *StateDB) StorageTrie(addr common.Address) Trie {
-// 	stateObject := s.getStateObject(addr)
-// 	if stateObject == nil {
-// 		return nil
-// 	}
-// 	cpy := stateObject.deepCopy(s)
-// 	cpy.updateTrie(s.db)
-// 	return cpy.getTrie(s.db)
-// }
+// StorageTrie returns the storage trie of an account.
+// The return value is a copy and is nil for non-existent accounts.
+func (s *StateDB) StorageTrie(addr common.Address) Trie {
+	stateObject := s.getStateObject(addr)
+	if stateObject == nil {
+		return nil
+	}
+	cpy := stateObject.deepCopy(s)
+	cpy.updateTrie(s.db)
+	return cpy.getTrie(s.db)
+}
 
 func (s *StateDB) HasSuicided(addr common.Address) bool {
-	// stateObject := s.getStateObject(addr)
-	// if stateObject != nil {
-	// 	return stateObject.suicided
-	// }
+	stateObject := s.getStateObject(addr)
+	if stateObject != nil {
+		return stateObject.suicided
+	}
 	return false
 }
 
@@ -392,25 +358,25 @@ func (s *StateDB) HasSuicided(addr common.Address) bool {
 
 // AddBalance adds amount to the account associated with addr.
 func (s *StateDB) AddBalance(addr common.Address, amount *big.Int) {
-	// stateObject := s.GetOrNewStateObject(addr)
-	// if stateObject != nil {
-	// 	stateObject.AddBalance(amount)
-	// }
+	stateObject := s.GetOrNewStateObject(addr)
+	if stateObject != nil {
+		stateObject.AddBalance(amount)
+	}
 }
 
 // SubBalance subtracts amount from the account associated with addr.
 func (s *StateDB) SubBalance(addr common.Address, amount *big.Int) {
-	// stateObject := s.GetOrNewStateObject(addr)
-	// if stateObject != nil {
-	// 	stateObject.SubBalance(amount)
-	// }
+	stateObject := s.GetOrNewStateObject(addr)
+	if stateObject != nil {
+		stateObject.SubBalance(amount)
+	}
 }
 
 func (s *StateDB) SetBalance(addr common.Address, amount *big.Int) {
-	// stateObject := s.GetOrNewStateObject(addr)
-	// if stateObject != nil {
-	// 	stateObject.SetBalance(amount)
-	// }
+	stateObject := s.GetOrNewStateObject(addr)
+	if stateObject != nil {
+		stateObject.SetBalance(amount)
+	}
 }
 
 func (s *StateDB) SetNonce(addr common.Address, nonce uint64) {
@@ -434,14 +400,20 @@ func (s *StateDB) SetState(addr common.Address, key, value common.Hash) {
 	}
 }
 
-// // SetStorage replaces the entire storage for the specified account with given
-// // storage. This function should only be used for debugging.
-// func (s *StateDB) SetStorage(addr common.Address, storage map[common.Hash]common.Hash) {
-// 	stateObject := s.GetOrNewStateObject(addr)
-// 	if stateObject != nil {
-// 		stateObject.SetStorage(storage)
-// 	}
-// }
+// SetStorage replaces the entire storage for the specified account with given
+// storage, keeping its balance, nonce and code. The account is recreated with
+// an empty storage trie, so none of the previous slots remain visible.
+func (s *StateDB) SetStorage(addr common.Address, storage map[common.Hash]common.Hash) {
+	newObj, prev := s.createObject(addr)
+	if prev != nil {
+		newObj.setBalance(prev.data.Balance)
+		newObj.setNonce(prev.data.Nonce)
+		newObj.setCode(common.BytesToHash(prev.CodeHash()), prev.Code(s.db))
+	}
+	for key, value := range storage {
+		newObj.SetState(s.db, key, value)
+	}
+}
 
 // Suicide marks the given account as suicided.
 // This clears the account balance.
@@ -449,17 +421,17 @@ func (s *StateDB) SetState(addr common.Address, key, value common.Hash) {
 // The account's state object is still available until the state is committed,
 // getStateObject will return a non-nil account after Suicide.
 func (s *StateDB) Suicide(addr common.Address) bool {
-	// stateObject := s.getStateObject(addr)
-	// if stateObject == nil {
-	// 	return false
-	// }
-	// s.journal.append(suicideChange{
-	// 	account:     &addr,
-	// 	prev:        stateObject.suicided,
-	// 	prevbalance: new(big.Int).Set(stateObject.Balance()),
-	// })
-	// stateObject.markSuicided()
-	// stateObject.data.Balance = new(big.Int)
+	stateObject := s.getStateObject(addr)
+	if stateObject == nil {
+		return false
+	}
+	s.journal.append(suicideChange{
+		account:     &addr,
+		prev:        stateObject.suicided,
+		prevbalance: new(big.Int).Set(stateObject.Balance()),
+	})
+	stateObject.markSuicided()
+	stateObject.setBalance(new(big.Int))
 
 	return true
 }
@@ -468,44 +440,28 @@ func (s *StateDB) Suicide(addr common.Address) bool {
 // // Setting, updating & deleting state object methods.
 // //
 
-// // updateStateObject writes the given object to the trie.
-// func (s *StateDB) updateStateObject(obj *stateObject) {
-// 	// Track the amount of time wasted on updating the account from the trie
-// 	if metrics.EnabledExpensive {
-// 		defer func(start time.Time) { s.AccountUpdates += time.Since(start) }(time.Now())
-// 	}
-// 	// Encode the account and update the account trie
-// 	addr := obj.Address()
-
-// 	data, err := rlp.EncodeToBytes(obj)
-// 	if err != nil {
-// 		panic(fmt.Errorf("can't encode object at %x: %v", addr[:], err))
-// 	}
-// 	if err = s.trie.TryUpdate(addr[:], data); err != nil {
-// 		s.setError(fmt.Errorf("updateStateObject (%x) error: %v", addr[:], err))
-// 	}
+// updateStateObject writes the given object to the trie.
+func (s *StateDB) updateStateObject(obj *stateObject) {
+	// Encode the account and update the account trie
+	addr := obj.Address()
 
-// 	// If state snapshotting is active, cache the data til commit. Note, this
-// 	// update mechanism is not symmetric to the deletion, because whereas it is
-// 	// enough to track account updates at commit time, deletions need tracking
-// 	// at transaction boundary level to ensure we capture state clearing.
-// 	if s.snap != nil {
-// 		s.snapAccounts[obj.addrHash] = snapshot.SlimAccountRLP(obj.data.Nonce, obj.data.Balance, obj.data.Root, obj.data.CodeHash)
-// 	}
-// }
+	data, err := rlp.EncodeToBytes(obj)
+	if err != nil {
+		panic(fmt.Errorf("can't encode object at %x: %v", addr[:], err))
+	}
+	if err = s.trie.TryUpdate(addr[:], data); err != nil {
+		s.setError(fmt.Errorf("updateStateObject (%x) error: %v", addr[:], err))
+	}
+}
 
-// // deleteStateObject removes the given object from the state trie.
-// func (s *StateDB) deleteStateObject(obj *stateObject) {
-// 	// Track the amount of time wasted on deleting the account from the trie
-// 	if metrics.EnabledExpensive {
-// 		defer func(start time.Time) { s.AccountUpdates += time.Since(start) }(time.Now())
-// 	}
-// 	// Delete the account from the trie
-// 	addr := obj.Address()
-// 	if err := s.trie.TryDelete(addr[:]); err != nil {
-// 		s.setError(fmt.Errorf("deleteStateObject (%x) error: %v", addr[:], err))
-// 	}
-// }
+// deleteStateObject removes the given object from the state trie.
+func (s *StateDB) deleteStateObject(obj *stateObject) {
+	// Delete the account from the trie
+	addr := obj.Address()
+	if err := s.trie.TryDelete(addr[:]); err != nil {
+		s.setError(fmt.Errorf("deleteStateObject (%x) error: %v", addr[:], err))
+	}
+}
 
 // getStateObject retrieves a state object given by the address, returning nil if
 // the object is not found or was deleted in this execution context. If you need
@@ -526,64 +482,20 @@ func (s *StateDB) getDeletedStateObject(addr common.Address) *stateObject {
 	if obj := s.stateObjects[addr]; obj != nil {
 		return obj
 	}
-	// If no live objects are available, attempt to use snapshots
-	var (
-		data *Account
-		// err  error
-	)
-	// if s.snap != nil {
-	// 	if metrics.EnabledExpensive {
-	// 		defer func(start time.Time) { s.SnapshotAccountReads += time.Since(start) }(time.Now())
-	// 	}
-	// 	var acc *snapshot.Account
-	// 	if acc, err = s.snap.Account(crypto.HashData(s.hasher, addr.Bytes())); err == nil {
-	// 		if acc == nil {
-	// 			return nil
-	// 		}
-	// 		data = &Account{
-	// 			Nonce:    acc.Nonce,
-	// 			Balance:  acc.Balance,
-	// 			CodeHash: acc.CodeHash,
-	// 			Root:     common.BytesToHash(acc.Root),
-	// 		}
-	// 		if len(data.CodeHash) == 0 {
-	// 			data.CodeHash = emptyCodeHash
-	// 		}
-	// 		if data.Root == (common.Hash{}) {
-	// 			data.Root = emptyRoot
-	// 		}
-	// 	}
-	// }
-	// // If snapshot unavailable or reading from it failed, load from the database
-	// if s.snap == nil || err != nil {
-	// 	if metrics.EnabledExpensive {
-	// 		defer func(start time.Time) { s.AccountReads += time.Since(start) }(time.Now())
-	// 	}
-	// 	enc, err := s.trie.TryGet(addr.Bytes())
-	// 	if err != nil {
-	// 		s.setError(fmt.Errorf("getDeleteStateObject (%x) error: %v", addr.Bytes(), err))
-	// 		return nil
-	// 	}
-	// 	if len(enc) == 0 {
-	// 		return nil
-	// 	}
-	enc, err := s.db.Get(addr.Bytes())
+	// If no live objects are available, load from the database
+	enc, err := s.trie.TryGet(addr.Bytes())
 	if err != nil {
+		s.setError(fmt.Errorf("getDeleteStateObject (%x) error: %v", addr.Bytes(), err))
 		return nil
 	}
-
-	data = new(Account)
+	if len(enc) == 0 {
+		return nil
+	}
+	data := new(Account)
 	if err := rlp.DecodeBytes(enc, data); err != nil {
 		log.Error("Failed to decode state object", "addr", addr, "err", err)
 		return nil
 	}
-
-	str := fmt.Sprintf("%v", data)
-	fmt.Println("############Account", str)
-
-	// fmt.Println("@@@@@@@@data=>", *data)
-	// fmt.Println("@@@@@@@@data.Code=>", data.Code)
-	// }
 	// Insert into the live set
 	obj := newObject(s, addr, *data)
 	s.setStateObject(obj)
@@ -616,11 +528,11 @@ func (s *StateDB) createObject(addr common.Address) (newobj, prev *stateObject)
 	// 	}
 	// }
 	newobj = newObject(s, addr, Account{})
-	// if prev == nil {
-	// 	s.journal.append(createObjectChange{account: &addr})
-	// } else {
-	// 	s.journal.append(resetObjectChange{prev: prev, prevdestruct: prevdestruct})
-	// }
+	if prev == nil {
+		s.journal.append(createObjectChange{account: &addr})
+	} else {
+		s.journal.append(resetObjectChange{prev: prev})
+	}
 	s.setStateObject(newobj)
 	if prev != nil && !prev.deleted {
 		return newobj, prev
@@ -653,158 +565,126 @@ func (s *StateDB) PrintAccount(addr common.Address) {
 }
 
 func (db *StateDB) ForEachStorage(addr common.Address, cb func(key, value common.Hash) bool) error {
-	// so := db.getStateObject(addr)
-	// if so == nil {
-	// 	return nil
-	// }
-	// it := trie.NewIterator(so.getTrie(db.db).NodeIterator(nil))
-
-	// for it.Next() {
-	// 	key := common.BytesToHash(db.trie.GetKey(it.Key))
-	// 	if value, dirty := so.dirtyStorage[key]; dirty {
-	// 		if !cb(key, value) {
-	// 			return nil
-	// 		}
-	// 		continue
-	// 	}
-
-	// 	if len(it.Value) > 0 {
-	// 		_, content, _, err := rlp.Split(it.Value)
-	// 		if err != nil {
-	// 			return err
-	// 		}
-	// 		if !cb(key, common.BytesToHash(content)) {
-	// 			return nil
-	// 		}
-	// 	}
-	// }
+	so := db.getStateObject(addr)
+	if so == nil {
+		return nil
+	}
+	it := trie.NewIterator(so.getTrie(db.db).NodeIterator(nil))
+
+	for it.Next() {
+		key := common.BytesToHash(db.trie.GetKey(it.Key))
+		if value, dirty := so.dirtyStorage[key]; dirty {
+			if !cb(key, value) {
+				return nil
+			}
+			continue
+		}
+
+		if len(it.Value) > 0 {
+			_, content, _, err := rlp.Split(it.Value)
+			if err != nil {
+				return err
+			}
+			if !cb(key, common.BytesToHash(content)) {
+				return nil
+			}
+		}
+	}
 	return nil
 }
 
 // Copy creates a deep, independent copy of the state.
 // Snapshots of the copied state cannot be applied to the copy.
 func (s *StateDB) Copy() *StateDB {
-	// // Copy all the basic fields, initialize the memory ones
-	// state := &StateDB{
-	// 	db:                  s.db,
-	// 	trie:                s.db.CopyTrie(s.trie),
-	// 	stateObjects:        make(map[common.Address]*stateObject, len(s.journal.dirties)),
-	// 	stateObjectsPending: make(map[common.Address]struct{}, len(s.stateObjectsPending)),
-	// 	stateObjectsDirty:   make(map[common.Address]struct{}, len(s.journal.dirties)),
-	// 	refund:              s.refund,
-	// 	logs:                make(map[common.Hash][]*types.Log, len(s.logs)),
-	// 	logSize:             s.logSize,
-	// 	preimages:           make(map[common.Hash][]byte, len(s.preimages)),
-	// 	journal:             newJournal(),
-	// 	hasher:              crypto.NewKeccakState(),
-	// }
-	// // Copy the dirty states, logs, and preimages
-	// for addr := range s.journal.dirties {
-	// 	// As documented [here](https://github.com/ethereum/go-ethereum/pull/16485#issuecomment-380438527),
-	// 	// and in the Finalise-method, there is a case where an object is in the journal but not
-	// 	// in the stateObjects: OOG after touch on ripeMD prior to Byzantium. Thus, we need to check for
-	// 	// nil
-	// 	if object, exist := s.stateObjects[addr]; exist {
-	// 		// Even though the original object is dirty, we are not copying the journal,
-	// 		// so we need to make sure that anyside effect the journal would have caused
-	// 		// during a commit (or similar op) is already applied to the copy.
-	// 		state.stateObjects[addr] = object.deepCopy(state)
-
-	// 		state.stateObjectsDirty[addr] = struct{}{}   // Mark the copy dirty to force internal (code/state) commits
-	// 		state.stateObjectsPending[addr] = struct{}{} // Mark the copy pending to force external (account) commits
-	// 	}
-	// }
-	// // Above, we don't copy the actual journal. This means that if the copy is copied, the
-	// // loop above will be a no-op, since the copy's journal is empty.
-	// // Thus, here we iterate over stateObjects, to enable copies of copies
-	// for addr := range s.stateObjectsPending {
-	// 	if _, exist := state.stateObjects[addr]; !exist {
-	// 		state.stateObjects[addr] = s.stateObjects[addr].deepCopy(state)
-	// 	}
-	// 	state.stateObjectsPending[addr] = struct{}{}
-	// }
-	// for addr := range s.stateObjectsDirty {
-	// 	if _, exist := state.stateObjects[addr]; !exist {
-	// 		state.stateObjects[addr] = s.stateObjects[addr].deepCopy(state)
-	// 	}
-	// 	state.stateObjectsDirty[addr] = struct{}{}
-	// }
-	// for hash, logs := range s.logs {
-	// 	cpy := make([]*types.Log, len(logs))
-	// 	for i, l := range logs {
-	// 		cpy[i] = new(types.Log)
-	// 		*cpy[i] = *l
-	// 	}
-	// 	state.logs[hash] = cpy
-	// }
-	// for hash, preimage := range s.preimages {
-	// 	state.preimages[hash] = preimage
-	// }
-	// // Do we need to copy the access list? In practice: No. At the start of a
-	// // transaction, the access list is empty. In practice, we only ever copy state
-	// // _between_ transactions/blocks, never in the middle of a transaction.
-	// // However, it doesn't cost us much to copy an empty list, so we do it anyway
-	// // to not blow up if we ever decide copy it in the middle of a transaction
-	// state.accessList = s.accessList.Copy()
-
-	// // If there's a prefetcher running, make an inactive copy of it that can
-	// // only access data but does not actively preload (since the user will not
-	// // know that they need to explicitly terminate an active copy).
-	// if s.prefetcher != nil {
-	// 	state.prefetcher = s.prefetcher.copy()
-	// }
-	// if s.snaps != nil {
-	// 	// In order for the miner to be able to use and make additions
-	// 	// to the snapshot tree, we need to copy that aswell.
-	// 	// Otherwise, any block mined by ourselves will cause gaps in the tree,
-	// 	// and force the miner to operate trie-backed only
-	// 	state.snaps = s.snaps
-	// 	state.snap = s.snap
-	// 	// deep copy needed
-	// 	state.snapDestructs = make(map[common.Hash]struct{})
-	// 	for k, v := range s.snapDestructs {
-	// 		state.snapDestructs[k] = v
-	// 	}
-	// 	state.snapAccounts = make(map[common.Hash][]byte)
-	// 	for k, v := range s.snapAccounts {
-	// 		state.snapAccounts[k] = v
-	// 	}
-	// 	state.snapStorage = make(map[common.Hash]map[common.Hash][]byte)
-	// 	for k, v := range s.snapStorage {
-	// 		temp := make(map[common.Hash][]byte)
-	// 		for kk, vv := range v {
-	// 			temp[kk] = vv
-	// 		}
-	// 		state.snapStorage[k] = temp
-	// 	}
-	// }
-	// return state
-	return nil
+	// Copy all the basic fields, initialize the memory ones
+	state := &StateDB{
+		db:                  s.db,
+		trie:                s.db.CopyTrie(s.trie),
+		originalRoot:        s.originalRoot,
+		stateObjects:        make(map[common.Address]*stateObject, len(s.journal.dirties)),
+		stateObjectsPending: make(map[common.Address]struct{}, len(s.stateObjectsPending)),
+		stateObjectsDirty:   make(map[common.Address]struct{}, len(s.journal.dirties)),
+		refund:              s.refund,
+		logs:                make(map[common.Hash][]*types.Log, len(s.logs)),
+		logSize:             s.logSize,
+		preimages:           make(map[common.Hash][]byte, len(s.preimages)),
+		journal:             newJournal(),
+		hasher:              crypto.NewKeccakState(),
+	}
+	// Copy the dirty states, logs, and preimages
+	for addr := range s.journal.dirties {
+		// As documented [here](https://github.com/ethereum/go-ethereum/pull/16485#issuecomment-380438527),
+		// and in the Finalise-method, there is a case where an object is in the journal but not
+		// in the stateObjects: OOG after touch on ripeMD prior to Byzantium. Thus, we need to check for
+		// nil
+		if object, exist := s.stateObjects[addr]; exist {
+			// Even though the original object is dirty, we are not copying the journal,
+			// so we need to make sure that anyside effect the journal would have caused
+			// during a commit (or similar op) is already applied to the copy.
+			state.stateObjects[addr] = object.deepCopy(state)
+
+			state.stateObjectsDirty[addr] = struct{}{}   // Mark the copy dirty to force internal (code/state) commits
+			state.stateObjectsPending[addr] = struct{}{} // Mark the copy pending to force external (account) commits
+		}
+	}
+	// Above, we don't copy the actual journal. This means that if the copy is copied, the
+	// loop above will be a no-op, since the copy's journal is empty.
+	// Thus, here we iterate over stateObjects, to enable copies of copies
+	for addr := range s.stateObjectsPending {
+		if _, exist := state.stateObjects[addr]; !exist {
+			state.stateObjects[addr] = s.stateObjects[addr].deepCopy(state)
+		}
+		state.stateObjectsPending[addr] = struct{}{}
+	}
+	for addr := range s.stateObjectsDirty {
+		if _, exist := state.stateObjects[addr]; !exist {
+			state.stateObjects[addr] = s.stateObjects[addr].deepCopy(state)
+		}
+		state.stateObjectsDirty[addr] = struct{}{}
+	}
+	for hash, logs := range s.logs {
+		cpy := make([]*types.Log, len(logs))
+		for i, l := range logs {
+			cpy[i] = new(types.Log)
+			*cpy[i] = *l
+		}
+		state.logs[hash] = cpy
+	}
+	for hash, preimage := range s.preimages {
+		state.preimages[hash] = preimage
+	}
+	// Do we need to copy the access list? In practice: No. At the start of a
+	// transaction, the access list is empty. In practice, we only ever copy state
+	// _between_ transactions/blocks, never in the middle of a transaction.
+	// However, it doesn't cost us much to copy an empty list, so we do it anyway
+	// to not blow up if we ever decide copy it in the middle of a transaction
+	state.accessList = s.accessList.Copy()
+
+	return state
 }
 
 // Snapshot returns an identifier for the current revision of the state.
 func (s *StateDB) Snapshot() int {
-	// id := s.nextRevisionId
-	// s.nextRevisionId++
-	// s.validRevisions = append(s.validRevisions, revision{id, s.journal.length()})
-	// return id
-	return 0
+	id := s.nextRevisionId
+	s.nextRevisionId++
+	s.validRevisions = append(s.validRevisions, revision{id, s.journal.length()})
+	return id
 }
 
 // RevertToSnapshot reverts all state changes made since the given revision.
 func (s *StateDB) RevertToSnapshot(revid int) {
-	// // Find the snapshot in the stack of valid snapshots.
-	// idx := sort.Search(len(s.validRevisions), func(i int) bool {
-	// 	return s.validRevisions[i].id >= revid
-	// })
-	// if idx == len(s.validRevisions) || s.validRevisions[idx].id != revid {
-	// 	panic(fmt.Errorf("revision id %v cannot be reverted", revid))
-	// }
-	// snapshot := s.validRevisions[idx].journalIndex
+	// Find the snapshot in the stack of valid snapshots.
+	idx := sort.Search(len(s.validRevisions), func(i int) bool {
+		return s.validRevisions[i].id >= revid
+	})
+	if idx == len(s.validRevisions) || s.validRevisions[idx].id != revid {
+		panic(fmt.Errorf("revision id %v cannot be reverted", revid))
+	}
+	snapshot := s.validRevisions[idx].journalIndex
 
-	// // Replay the journal to undo changes and remove invalidated snapshots
-	// s.journal.revert(s, snapshot)
-	// s.validRevisions = s.validRevisions[:idx]
+	// Replay the journal to undo changes and remove invalidated snapshots
+	s.journal.revert(s, snapshot)
+	s.validRevisions = s.validRevisions[:idx]
 }
 
 // GetRefund returns the current value of the refund counter.
@@ -812,202 +692,120 @@ func (s *StateDB) GetRefund() uint64 {
 	return s.refund
 }
 
-// // Finalise finalises the state by removing the s destructed objects and clears
-// // the journal as well as the refunds. Finalise, however, will not push any updates
-// // into the tries just yet. Only IntermediateRoot or Commit will do that.
-// func (s *StateDB) Finalise(deleteEmptyObjects bool) {
-// 	addressesToPrefetch := make([][]byte, 0, len(s.journal.dirties))
-// 	for addr := range s.journal.dirties {
-// 		obj, exist := s.stateObjects[addr]
-// 		if !exist {
-// 			// ripeMD is 'touched' at block 1714175, in tx 0x1237f737031e40bcde4a8b7e717b2d15e3ecadfe49bb1bbc71ee9deb09c6fcf2
-// 			// That tx goes out of gas, and although the notion of 'touched' does not exist there, the
-// 			// touch-event will still be recorded in the journal. Since ripeMD is a special snowflake,
-// 			// it will persist in the journal even though the journal is reverted. In this special circumstance,
-// 			// it may exist in `s.journal.dirties` but not in `s.stateObjects`.
-// 			// Thus, we can safely ignore it here
-// 			continue
-// 		}
-// 		if obj.suicided || (deleteEmptyObjects && obj.empty()) {
-// 			obj.deleted = true
-
-// 			// If state snapshotting is active, also mark the destruction there.
-// 			// Note, we can't do this only at the end of a block because multiple
-// 			// transactions within the same block might self destruct and then
-// 			// ressurrect an account; but the snapshotter needs both events.
-// 			if s.snap != nil {
-// 				s.snapDestructs[obj.addrHash] = struct{}{} // We need to maintain account deletions explicitly (will remain set indefinitely)
-// 				delete(s.snapAccounts, obj.addrHash)       // Clear out any previously updated account data (may be recreated via a ressurrect)
-// 				delete(s.snapStorage, obj.addrHash)        // Clear out any previously updated storage data (may be recreated via a ressurrect)
-// 			}
-// 		} else {
-// 			obj.finalise(true) // Prefetch slots in the background
-// 		}
-// 		s.stateObjectsPending[addr] = struct{}{}
-// 		s.stateObjectsDirty[addr] = struct{}{}
-
-// 		// At this point, also ship the address off to the precacher. The precacher
-// 		// will start loading tries, and when the change is eventually committed,
-// 		// the commit-phase will be a lot faster
-// 		addressesToPrefetch = append(addressesToPrefetch, common.CopyBytes(addr[:])) // Copy needed for closure
-// 	}
-// 	if s.prefetcher != nil && len(addressesToPrefetch) > 0 {
-// 		s.prefetcher.prefetch(s.originalRoot, addressesToPrefetch)
-// 	}
-// 	// Invalidate journal because reverting across transactions is not allowed.
-// 	s.clearJournalAndRefund()
-// }
-
-// // IntermediateRoot computes the current root hash of the state trie.
-// // It is called in between transactions to get the root hash that
-// // goes into transaction receipts.
-// func (s *StateDB) IntermediateRoot(deleteEmptyObjects bool) common.Hash {
-// 	// Finalise all the dirty storage states and write them into the tries
-// 	s.Finalise(deleteEmptyObjects)
-
-// 	// If there was a trie prefetcher operating, it gets aborted and irrevocably
-// 	// modified after we start retrieving tries. Remove it from the statedb after
-// 	// this round of use.
-// 	//
-// 	// This is weird pre-byzantium since the first tx runs with a prefetcher and
-// 	// the remainder without, but pre-byzantium even the initial prefetcher is
-// 	// useless, so no sleep lost.
-// 	prefetcher := s.prefetcher
-// 	if s.prefetcher != nil {
-// 		defer func() {
-// 			s.prefetcher.close()
-// 			s.prefetcher = nil
-// 		}()
-// 	}
-// 	// Although naively it makes sense to retrieve the account trie and then do
-// 	// the contract storage and account updates sequentially, that short circuits
-// 	// the account prefetcher. Instead, let's process all the storage updates
-// 	// first, giving the account prefeches just a few more milliseconds of time
-// 	// to pull useful data from disk.
-// 	for addr := range s.stateObjectsPending {
-// 		if obj := s.stateObjects[addr]; !obj.deleted {
-// 			obj.updateRoot(s.db)
-// 		}
-// 	}
-// 	// Now we're about to start to write changes to the trie. The trie is so far
-// 	// _untouched_. We can check with the prefetcher, if it can give us a trie
-// 	// which has the same root, but also has some content loaded into it.
-// 	if prefetcher != nil {
-// 		if trie := prefetcher.trie(s.originalRoot); trie != nil {
-// 			s.trie = trie
-// 		}
-// 	}
-// 	usedAddrs := make([][]byte, 0, len(s.stateObjectsPending))
-// 	for addr := range s.stateObjectsPending {
-// 		if obj := s.stateObjects[addr]; obj.deleted {
-// 			s.deleteStateObject(obj)
-// 		} else {
-// 			s.updateStateObject(obj)
-// 		}
-// 		usedAddrs = append(usedAddrs, common.CopyBytes(addr[:])) // Copy needed for closure
-// 	}
-// 	if prefetcher != nil {
-// 		prefetcher.used(s.originalRoot, usedAddrs)
-// 	}
-// 	if len(s.stateObjectsPending) > 0 {
-// 		s.stateObjectsPending = make(map[common.Address]struct{})
-// 	}
-// 	// Track the amount of time wasted on hashing the account trie
-// 	if metrics.EnabledExpensive {
-// 		defer func(start time.Time) { s.AccountHashes += time.Since(start) }(time.Now())
-// 	}
-// 	return s.trie.Hash()
-// }
+// Finalise finalises the state by removing the s destructed objects and clears
+// the journal as well as the refunds. Finalise, however, will not push any updates
+// into the tries just yet. Only IntermediateRoot or Commit will do that.
+func (s *StateDB) Finalise(deleteEmptyObjects bool) {
+	for addr := range s.journal.dirties {
+		obj, exist := s.stateObjects[addr]
+		if !exist {
+			// ripeMD is 'touched' at block 1714175, in tx 0x1237f737031e40bcde4a8b7e717b2d15e3ecadfe49bb1bbc71ee9deb09c6fcf2
+			// That tx goes out of gas, and although the notion of 'touched' does not exist there, the
+			// touch-event will still be recorded in the journal. Since ripeMD is a special snowflake,
+			// it will persist in the journal even though the journal is reverted. In this special circumstance,
+			// it may exist in `s.journal.dirties` but not in `s.stateObjects`.
+			// Thus, we can safely ignore it here
+			continue
+		}
+		if obj.suicided || (deleteEmptyObjects && obj.empty()) {
+			obj.deleted = true
+		} else {
+			obj.finalise()
+		}
+		s.stateObjectsPending[addr] = struct{}{}
+		s.stateObjectsDirty[addr] = struct{}{}
+	}
+	// Invalidate journal because reverting across transactions is not allowed.
+	s.clearJournalAndRefund()
+}
+
+// IntermediateRoot computes the current root hash of the state trie.
+// It is called in between transactions to get the root hash that
+// goes into transaction receipts.
+func (s *StateDB) IntermediateRoot(deleteEmptyObjects bool) common.Hash {
+	// Finalise all the dirty storage states and write them into the tries
+	s.Finalise(deleteEmptyObjects)
+
+	// Process all the storage updates first, the account trie is only touched
+	// once every storage root is known.
+	for addr := range s.stateObjectsPending {
+		if obj := s.stateObjects[addr]; !obj.deleted {
+			obj.updateRoot(s.db)
+		}
+	}
+	for addr := range s.stateObjectsPending {
+		if obj := s.stateObjects[addr]; obj.deleted {
+			s.deleteStateObject(obj)
+		} else {
+			s.updateStateObject(obj)
+		}
+	}
+	if len(s.stateObjectsPending) > 0 {
+		s.stateObjectsPending = make(map[common.Address]struct{})
+	}
+	return s.trie.Hash()
+}
 
-// // Prepare sets the current transaction hash and index which are
-// // used when the EVM emits new state logs.
-// func (s *StateDB) Prepare(thash common.Hash, ti int) {
-// 	s.thash = thash
-// 	s.txIndex = ti
-// 	s.accessList = newAccessList()
-// }
+// Prepare sets the current transaction hash and index which are
+// used when the EVM emits new state logs.
+func (s *StateDB) Prepare(thash common.Hash, ti int) {
+	s.thash = thash
+	s.txIndex = ti
+	s.accessList = newAccessList()
+}
 
-// func (s *StateDB) clearJournalAndRefund() {
-// 	if len(s.journal.entries) > 0 {
-// 		s.journal = newJournal()
-// 		s.refund = 0
-// 	}
-// 	s.validRevisions = s.validRevisions[:0] // Snapshots can be created without journal entires
-// }
+func (s *StateDB) clearJournalAndRefund() {
+	if len(s.journal.entries) > 0 {
+		s.journal = newJournal()
+		s.refund = 0
+	}
+	s.validRevisions = s.validRevisions[:0] // Snapshots can be created without journal entires
+}
 
-// // Commit writes the state to the underlying in-memory trie database.
-// func (s *StateDB) Commit(deleteEmptyObjects bool) (common.Hash, error) {
-// 	if s.dbErr != nil {
-// 		return common.Hash{}, fmt.Errorf("commit aborted due to earlier error: %v", s.dbErr)
-// 	}
-// 	// Finalize any pending changes and merge everything into the tries
-// 	s.IntermediateRoot(deleteEmptyObjects)
-
-// 	// Commit objects to the trie, measuring the elapsed time
-// 	codeWriter := s.db.TrieDB().DiskDB().NewBatch()
-// 	for addr := range s.stateObjectsDirty {
-// 		if obj := s.stateObjects[addr]; !obj.deleted {
-// 			// Write any contract code associated with the state object
-// 			if obj.code != nil && obj.dirtyCode {
-// 				rawdb.WriteCode(codeWriter, common.BytesToHash(obj.CodeHash()), obj.code)
-// 				obj.dirtyCode = false
-// 			}
-// 			// Write any storage changes in the state object to its storage trie
-// 			if err := obj.CommitTrie(s.db); err != nil {
-// 				return common.Hash{}, err
-// 			}
-// 		}
-// 	}
-// 	if len(s.stateObjectsDirty) > 0 {
-// 		s.stateObjectsDirty = make(map[common.Address]struct{})
-// 	}
-// 	if codeWriter.ValueSize() > 0 {
-// 		if err := codeWriter.Write(); err != nil {
-// 			log.Crit("Failed to commit dirty codes", "error", err)
-// 		}
-// 	}
-// 	// Write the account trie changes, measuing the amount of wasted time
-// 	var start time.Time
-// 	if metrics.EnabledExpensive {
-// 		start = time.Now()
-// 	}
-// 	// The onleaf func is called _serially_, so we can reuse the same account
-// 	// for unmarshalling every time.
-// 	var account Account
-// 	root, err := s.trie.Commit(func(_ [][]byte, _ []byte, leaf []byte, parent common.Hash) error {
-// 		if err := rlp.DecodeBytes(leaf, &account); err != nil {
-// 			return nil
-// 		}
-// 		if account.Root != emptyRoot {
-// 			s.db.TrieDB().Reference(account.Root, parent)
-// 		}
-// 		return nil
-// 	})
-// 	if metrics.EnabledExpensive {
-// 		s.AccountCommits += time.Since(start)
-// 	}
-// 	// If snapshotting is enabled, update the snapshot tree with this new version
-// 	if s.snap != nil {
-// 		if metrics.EnabledExpensive {
-// 			defer func(start time.Time) { s.SnapshotCommits += time.Since(start) }(time.Now())
-// 		}
-// 		// Only update if there's a state transition (skip empty Clique blocks)
-// 		if parent := s.snap.Root(); parent != root {
-// 			if err := s.snaps.Update(root, parent, s.snapDestructs, s.snapAccounts, s.snapStorage); err != nil {
-// 				log.Warn("Failed to update snapshot tree", "from", parent, "to", root, "err", err)
-// 			}
-// 			// Keep 128 diff layers in the memory, persistent layer is 129th.
-// 			// - head layer is paired with HEAD state
-// 			// - head-1 layer is paired with HEAD-1 state
-// 			// - head-127 layer(bottom-most diff layer) is paired with HEAD-127 state
-// 			if err := s.snaps.Cap(root, 128); err != nil {
-// 				log.Warn("Failed to cap snapshot tree", "root", root, "layers", 128, "err", err)
-// 			}
-// 		}
-// 		s.snap, s.snapDestructs, s.snapAccounts, s.snapStorage = nil, nil, nil, nil
-// 	}
-// 	return root, err
-// }
+// Commit writes the state to the underlying trie database.
+func (s *StateDB) Commit(deleteEmptyObjects bool) (common.Hash, error) {
+	if s.dbErr != nil {
+		return common.Hash{}, fmt.Errorf("commit aborted due to earlier error: %v", s.dbErr)
+	}
+	// Finalize any pending changes and merge everything into the tries
+	s.IntermediateRoot(deleteEmptyObjects)
+
+	// Commit objects to the trie
+	codeWriter := s.db.TrieDB().DiskDB().NewBatch()
+	for addr := range s.stateObjectsDirty {
+		if obj := s.stateObjects[addr]; !obj.deleted {
+			// Write any contract code associated with the state object
+			if obj.code != nil && obj.dirtyCode {
+				codeWriter.Put(obj.CodeHash(), obj.code)
+				obj.dirtyCode = false
+			}
+			// Write any storage changes in the state object to its storage trie
+			if err := obj.CommitTrie(s.db); err != nil {
+				return common.Hash{}, err
+			}
+		}
+	}
+	if len(s.stateObjectsDirty) > 0 {
+		s.stateObjectsDirty = make(map[common.Address]struct{})
+	}
+	if codeWriter.ValueSize() > 0 {
+		if err := codeWriter.Write(); err != nil {
+			return common.Hash{}, fmt.Errorf("failed to commit dirty codes: %v", err)
+		}
+	}
+	// Write the account trie changes. The onleaf func is called _serially_,
+	// so we can reuse the same account for unmarshalling every time.
+	var account Account
+	return s.trie.Commit(func(_ [][]byte, _ []byte, leaf []byte, parent common.Hash) error {
+		if err := rlp.DecodeBytes(leaf, &account); err != nil {
+			return nil
+		}
+		if account.Root != emptyRoot {
+			s.db.TrieDB().Reference(account.Root, parent)
+		}
+		return nil
+	})
+}
 
 // PrepareAccessList handles the preparatory steps for executing a state transition with
 // regards to both EIP-2929 and EIP-2930:
@@ -1019,55 +817,53 @@ func (s *StateDB) GetRefund() uint64 {
 //
 // This method should only be called if Berlin/2929+2930 is applicable at the current number.
 func (s *StateDB) PrepareAccessList(sender common.Address, dst *common.Address, precompiles []common.Address, list types.AccessList) {
-	// s.AddAddressToAccessList(sender)
-	// if dst != nil {
-	// 	s.AddAddressToAccessList(*dst)
-	// 	// If it's a create-tx, the destination will be added inside evm.create
-	// }
-	// for _, addr := range precompiles {
-	// 	s.AddAddressToAccessList(addr)
-	// }
-	// for _, el := range list {
-	// 	s.AddAddressToAccessList(el.Address)
-	// 	for _, key := range el.StorageKeys {
-	// 		s.AddSlotToAccessList(el.Address, key)
-	// 	}
-	// }
+	s.AddAddressToAccessList(sender)
+	if dst != nil {
+		s.AddAddressToAccessList(*dst)
+		// If it's a create-tx, the destination will be added inside evm.create
+	}
+	for _, addr := range precompiles {
+		s.AddAddressToAccessList(addr)
+	}
+	for _, el := range list {
+		s.AddAddressToAccessList(el.Address)
+		for _, key := range el.StorageKeys {
+			s.AddSlotToAccessList(el.Address, key)
+		}
+	}
 }
 
 // AddAddressToAccessList adds the given address to the access list
 func (s *StateDB) AddAddressToAccessList(addr common.Address) {
-	// if s.accessList.AddAddress(addr) {
-	// 	s.journal.append(accessListAddAccountChange{&addr})
-	// }
+	if s.accessList.AddAddress(addr) {
+		s.journal.append(accessListAddAccountChange{&addr})
+	}
 }
 
 // AddSlotToAccessList adds the given (address, slot)-tuple to the access list
 func (s *StateDB) AddSlotToAccessList(addr common.Address, slot common.Hash) {
-	// addrMod, slotMod := s.accessList.AddSlot(addr, slot)
-	// if addrMod {
-	// 	// In practice, this should not happen, since there is no way to enter the
-	// 	// scope of 'address' without having the 'address' become already added
-	// 	// to the access list (via call-variant, create, etc).
-	// 	// Better safe than sorry, though
-	// 	s.journal.append(accessListAddAccountChange{&addr})
-	// }
-	// if slotMod {
-	// 	s.journal.append(accessListAddSlotChange{
-	// 		address: &addr,
-	// 		slot:    &slot,
-	// 	})
-	// }
+	addrMod, slotMod := s.accessList.AddSlot(addr, slot)
+	if addrMod {
+		// In practice, this should not happen, since there is no way to enter the
+		// scope of 'address' without having the 'address' become already added
+		// to the access list (via call-variant, create, etc).
+		// Better safe than sorry, though
+		s.journal.append(accessListAddAccountChange{&addr})
+	}
+	if slotMod {
+		s.journal.append(accessListAddSlotChange{
+			address: &addr,
+			slot:    &slot,
+		})
+	}
 }
 
 // AddressInAccessList returns true if the given address is in the access list.
 func (s *StateDB) AddressInAccessList(addr common.Address) bool {
-	// return s.accessList.ContainsAddress(addr)
-	return true
+	return s.accessList.ContainsAddress(addr)
 }
 
 // SlotInAccessList returns true if the given (address, slot)-tuple is in the access list.
 func (s *StateDB) SlotInAccessList(addr common.Address, slot common.Hash) (addressPresent bool, slotPresent bool) {
-	// return s.accessList.Contains(addr, slot)
-	return true, true
+	return s.accessList.Contains(addr, slot)
 }
@@ -0,0 +1,296 @@
+package state
+
+import (
+	"ethereum-evm/common/hexutil"
+	"ethereum-evm/ethdb/memorydb"
+	"ethereum-evm/trie"
+	"math/big"
+	"testing"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/crypto"
+	"github.com/ethereum/go-ethereum/rlp"
+)
+
+func TestCommitAndReopen(t *testing.T) {
+	var (
+		diskdb  = memorydb.New()
+		db      = NewDatabase(diskdb)
+		account = common.HexToAddress("0x01")
+		code    = common.HexToAddress("0x02")
+		slot    = common.HexToHash("0x01")
+		value   = common.HexToHash("0x2a")
+		balance = big.NewInt(1000000000000000000)
+		// Root of the same state as computed by go-ethereum.
+		want = common.HexToHash("0x471bab83488a7255b984480dd1569da7523d1682c7f3674624707f9165b0d12c")
+	)
+	state, _ := New(types.EmptyRootHash, db)
+	state.SetBalance(account, balance)
+	state.SetNonce(account, 1)
+	state.SetCode(code, []byte{0x60, 0x00})
+	state.SetState(code, slot, value)
+
+	if root := state.IntermediateRoot(true); root != want {
+		t.Fatalf("intermediate root mismatch: have %x, want %x", root, want)
+	}
+	root, err := state.Commit(true)
+	if err != nil {
+		t.Fatalf("failed to commit state: %v", err)
+	}
+	if root != want {
+		t.Fatalf("committed root mismatch: have %x, want %x", root, want)
+	}
+	if err := db.TrieDB().Commit(root, false, nil); err != nil {
+		t.Fatalf("failed to flush trie nodes: %v", err)
+	}
+	// Reopen the committed state from disk through a fresh database.
+	state, err = New(root, NewDatabase(diskdb))
+	if err != nil {
+		t.Fatalf("failed to reopen state: %v", err)
+	}
+	if have := state.GetBalance(account); have.Cmp(balance) != 0 {
+		t.Errorf("balance mismatch: have %v, want %v", have, balance)
+	}
+	if have := state.GetNonce(account); have != 1 {
+		t.Errorf("nonce mismatch: have %d, want 1", have)
+	}
+	if have := state.GetCode(code); len(have) != 2 || have[0] != 0x60 {
+		t.Errorf("code mismatch: have %x", have)
+	}
+	if have := state.GetState(code, slot); have != value {
+		t.Errorf("storage mismatch: have %x, want %x", have, value)
+	}
+}
+
+func TestSnapshotRevert(t *testing.T) {
+	var (
+		state, _ = New(types.EmptyRootHash, NewDatabase(memorydb.New()))
+		addr     = common.HexToAddress("0x01")
+		slot     = common.HexToHash("0x01")
+	)
+	state.SetBalance(addr, big.NewInt(1))
+	state.SetState(addr, slot, common.HexToHash("0x01"))
+	root := state.IntermediateRoot(true)
+
+	outer := state.Snapshot()
+	state.SetBalance(addr, big.NewInt(2))
+	inner := state.Snapshot()
+	state.SetNonce(addr, 5)
+	state.SetState(addr, slot, common.HexToHash("0x02"))
+	state.AddLog(&types.Log{Address: addr})
+
+	state.RevertToSnapshot(inner)
+	if have := state.GetNonce(addr); have != 0 {
+		t.Errorf("nonce not reverted: %d", have)
+	}
+	if have := state.GetState(addr, slot); have != common.HexToHash("0x01") {
+		t.Errorf("storage not reverted: %x", have)
+	}
+	if have := state.GetBalance(addr); have.Cmp(big.NewInt(2)) != 0 {
+		t.Errorf("balance of the outer revision reverted too: %v", have)
+	}
+	if logs := state.Logs(); len(logs) != 0 {
+		t.Errorf("logs not reverted: %v", logs)
+	}
+	state.RevertToSnapshot(outer)
+	if have := state.IntermediateRoot(true); have != root {
+		t.Errorf("root mismatch after revert: have %x, want %x", have, root)
+	}
+}
+
+func TestForEachStorage(t *testing.T) {
+	var (
+		db       = NewDatabase(memorydb.New())
+		state, _ = New(types.EmptyRootHash, db)
+		addr     = common.HexToAddress("0x01")
+	)
+	state.SetNonce(addr, 1)
+	state.SetState(addr, common.HexToHash("0x01"), common.HexToHash("0x0a"))
+	state.SetState(addr, common.HexToHash("0x02"), common.HexToHash("0x0b"))
+	root, err := state.Commit(true)
+	if err != nil {
+		t.Fatalf("failed to commit state: %v", err)
+	}
+	state, _ = New(root, db)
+	state.SetState(addr, common.HexToHash("0x02"), common.HexToHash("0x0c"))
+
+	want := map[common.Hash]common.Hash{
+		common.HexToHash("0x01"): common.HexToHash("0x0a"),
+		common.HexToHash("0x02"): common.HexToHash("0x0c"),
+	}
+	have := make(map[common.Hash]common.Hash)
+	if err := state.ForEachStorage(addr, func(key, value common.Hash) bool {
+		have[key] = value
+		return true
+	}); err != nil {
+		t.Fatalf("failed to iterate storage: %v", err)
+	}
+	if len(have) != len(want) {
+		t.Fatalf("storage size mismatch: have %d, want %d", len(have), len(want))
+	}
+	for key, value := range want {
+		if have[key] != value {
+			t.Errorf("slot %x mismatch: have %x, want %x", key, have[key], value)
+		}
+	}
+}
+
+func TestGetCommittedState(t *testing.T) {
+	var (
+		diskdb = memorydb.New()
+		db     = NewDatabase(diskdb)
+		addr   = common.HexToAddress("0x01")
+		slot   = common.HexToHash("0x01")
+	)
+	state, _ := New(types.EmptyRootHash, db)
+	state.SetNonce(addr, 1)
+	state.SetState(addr, slot, common.HexToHash("0x0a"))
+	root, err := state.Commit(true)
+	if err != nil {
+		t.Fatalf("failed to commit state: %v", err)
+	}
+	if err := db.TrieDB().Commit(root, false, nil); err != nil {
+		t.Fatalf("failed to flush trie nodes: %v", err)
+	}
+	// The committed value is read back from the trie of the reopened state,
+	// and stays the original value until the transaction is finalised.
+	state, _ = New(root, NewDatabase(diskdb))
+	state.SetState(addr, slot, common.HexToHash("0x0b"))
+	if have := state.GetCommittedState(addr, slot); have != common.HexToHash("0x0a") {
+		t.Errorf("committed value mismatch: have %x, want 0a", have)
+	}
+	if have := state.GetState(addr, slot); have != common.HexToHash("0x0b") {
+		t.Errorf("current value mismatch: have %x, want 0b", have)
+	}
+	state.Finalise(true)
+	if have := state.GetCommittedState(addr, slot); have != common.HexToHash("0x0b") {
+		t.Errorf("committed value after finalise mismatch: have %x, want 0b", have)
+	}
+	if have := state.GetCommittedState(common.HexToAddress("0x02"), slot); have != (common.Hash{}) {
+		t.Errorf("committed value of missing account: have %x", have)
+	}
+}
+
+func TestSetStorage(t *testing.T) {
+	var (
+		db       = NewDatabase(memorydb.New())
+		state, _ = New(types.EmptyRootHash, db)
+		addr     = common.HexToAddress("0x01")
+	)
+	state.SetBalance(addr, big.NewInt(1))
+	state.SetNonce(addr, 1)
+	state.SetCode(addr, []byte{0x60, 0x00})
+	state.SetState(addr, common.HexToHash("0x01"), common.HexToHash("0x0a"))
+	root, err := state.Commit(true)
+	if err != nil {
+		t.Fatalf("failed to commit state: %v", err)
+	}
+	state, _ = New(root, db)
+	snap := state.Snapshot()
+	state.SetStorage(addr, map[common.Hash]common.Hash{common.HexToHash("0x02"): common.HexToHash("0x0b")})
+
+	if have := state.GetState(addr, common.HexToHash("0x01")); have != (common.Hash{}) {
+		t.Errorf("replaced slot still visible: %x", have)
+	}
+	if have := state.GetState(addr, common.HexToHash("0x02")); have != common.HexToHash("0x0b") {
+		t.Errorf("storage mismatch: have %x, want 0b", have)
+	}
+	if state.GetBalance(addr).Int64() != 1 || state.GetNonce(addr) != 1 || len(state.GetCode(addr)) != 2 {
+		t.Errorf("account fields not kept")
+	}
+	state.RevertToSnapshot(snap)
+	if have := state.GetState(addr, common.HexToHash("0x01")); have != common.HexToHash("0x0a") {
+		t.Errorf("storage not reverted: %x", have)
+	}
+	if have := state.IntermediateRoot(true); have != root {
+		t.Errorf("root mismatch after revert: have %x, want %x", have, root)
+	}
+}
+
+func TestGetAccountProof(t *testing.T) {
+	var (
+		state, _ = New(types.EmptyRootHash, NewDatabase(memorydb.New()))
+		addr     = common.HexToAddress("0x01")
+		missing  = common.HexToAddress("0x02")
+		slot     = common.HexToHash("0x01")
+		value    = common.HexToHash("0x2a")
+	)
+	state.SetBalance(addr, big.NewInt(7))
+	state.SetNonce(addr, 3)
+	state.SetState(addr, slot, value)
+	root, err := state.Commit(true)
+	if err != nil {
+		t.Fatalf("failed to commit state: %v", err)
+	}
+	res, err := state.GetAccountProof(addr, []common.Hash{slot})
+	if err != nil {
+		t.Fatalf("failed to get proof: %v", err)
+	}
+	// Verify the account against the state root.
+	enc, err := trie.VerifyProof(root, crypto.Keccak256(addr.Bytes()), decodeProof(t, res.AccountProof))
+	if err != nil {
+		t.Fatalf("failed to verify account proof: %v", err)
+	}
+	var account Account
+	if err := rlp.DecodeBytes(enc, &account); err != nil {
+		t.Fatalf("failed to decode account: %v", err)
+	}
+	if account.Nonce != 3 || account.Balance.Cmp(big.NewInt(7)) != 0 || account.Root != res.StorageHash {
+		t.Errorf("proven account mismatch: %+v, result %+v", account, res)
+	}
+	// Verify the storage slot against the proven storage root.
+	if len(res.StorageProof) != 1 {
+		t.Fatalf("storage proof count mismatch: have %d, want 1", len(res.StorageProof))
+	}
+	enc, err = trie.VerifyProof(res.StorageHash, crypto.Keccak256(slot.Bytes()), decodeProof(t, res.StorageProof[0].Proof))
+	if err != nil {
+		t.Fatalf("failed to verify storage proof: %v", err)
+	}
+	_, content, _, _ := rlp.Split(enc)
+	if common.BytesToHash(content) != value || res.StorageProof[0].Value.ToInt().Cmp(value.Big()) != 0 {
+		t.Errorf("proven slot mismatch: have %x, result %v", content, res.StorageProof[0].Value)
+	}
+	// Accounts that don't exist are proven absent.
+	res, err = state.GetAccountProof(missing, nil)
+	if err != nil {
+		t.Fatalf("failed to get proof of missing account: %v", err)
+	}
+	enc, err = trie.VerifyProof(root, crypto.Keccak256(missing.Bytes()), decodeProof(t, res.AccountProof))
+	if err != nil || enc != nil {
+		t.Errorf("absence proof failed: value %x, err %v", enc, err)
+	}
+	if res.StorageHash != types.EmptyRootHash || res.CodeHash != types.EmptyCodeHash {
+		t.Errorf("missing account hashes mismatch: storage %x, code %x", res.StorageHash, res.CodeHash)
+	}
+}
+
+func decodeProof(t *testing.T, proof []string) trie.ProofList {
+	var list trie.ProofList
+	for _, node := range proof {
+		enc, err := hexutil.Decode(node)
+		if err != nil {
+			t.Fatalf("invalid proof node %q: %v", node, err)
+		}
+		list = append(list, enc)
+	}
+	return list
+}
+
+func TestLogsOrder(t *testing.T) {
+	state, _ := New(types.EmptyRootHash, NewDatabase(memorydb.New()))
+	for i := 0; i < 16; i++ {
+		state.Prepare(common.BigToHash(big.NewInt(int64(i))), i)
+		state.AddLog(&types.Log{})
+		state.AddLog(&types.Log{})
+	}
+	logs := state.Logs()
+	if len(logs) != 32 {
+		t.Fatalf("log count mismatch: have %d, want 32", len(logs))
+	}
+	for i, log := range logs {
+		if log.TxIndex != uint(i/2) || log.Index != uint(i) {
+			t.Errorf("log %d out of order: tx %d, index %d", i, log.TxIndex, log.Index)
+		}
+	}
+}
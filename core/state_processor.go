@@ -0,0 +1,170 @@
+// Copyright 2015 The go-ethereum Authors
+// This file is part of the go-ethereum library.
+//
+// The go-ethereum library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-ethereum library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-ethereum library. If not, see <http://www.gnu.org/licenses/>.
+
+package core
+
+import (
+	"ethereum-evm/core/state"
+	"ethereum-evm/core/vm"
+	"ethereum-evm/params"
+	"ethereum-evm/trie"
+	"fmt"
+	"math/big"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/crypto"
+)
+
+// gweiFactor converts withdrawal amounts, which are denominated in gwei, to wei.
+var gweiFactor = big.NewInt(1e9)
+
+// ProcessResult is the outcome of processing a block: the receipts and logs of
+// its transactions, the gas they used and the roots committing to them.
+type ProcessResult struct {
+	Receipts    types.Receipts
+	Logs        []*types.Log
+	GasUsed     uint64
+	Bloom       types.Bloom
+	TxRoot      common.Hash // Root of the transaction trie
+	ReceiptRoot common.Hash // Root of the receipt trie
+	Root        common.Hash // State root after the block
+}
+
+// StateProcessor is a basic Processor, which takes care of transitioning
+// state from one point to another.
+type StateProcessor struct {
+	config *params.ChainConfig // Chain configuration options
+	chain  ChainContext        // Canonical headers served to BLOCKHASH
+}
+
+// NewStateProcessor initialises a new StateProcessor.
+func NewStateProcessor(config *params.ChainConfig, chain ChainContext) *StateProcessor {
+	return &StateProcessor{
+		config: config,
+		chain:  chain,
+	}
+}
+
+// Process processes the state changes according to the Ethereum rules by running
+// the transaction messages using the statedb and applying any withdrawals.
+//
+// Process returns the receipts and logs accumulated during the process, the
+// amount of gas used and the transaction, receipt and state roots. If any of
+// the transactions failed to execute due to insufficient gas it will return
+// an error. Block rewards are consensus engine specific and are not applied.
+func (p *StateProcessor) Process(block *types.Block, statedb *state.StateDB, cfg vm.Config) (*ProcessResult, error) {
+	var (
+		receipts    types.Receipts
+		usedGas     = new(uint64)
+		header      = block.Header()
+		blockHash   = block.Hash()
+		blockNumber = block.Number()
+		allLogs     []*types.Log
+		gp          = new(GasPool).AddGas(block.GasLimit())
+	)
+	var (
+		context = NewEVMBlockContext(header, p.chain)
+		vmenv   = vm.NewEVM(context, vm.TxContext{}, statedb, p.config, cfg)
+		signer  = MakeSigner(p.config, header.Number)
+	)
+	// Iterate over and process the individual transactions
+	for i, tx := range block.Transactions() {
+		msg, err := TransactionToMessage(tx, signer, header.BaseFee)
+		if err != nil {
+			return nil, fmt.Errorf("could not apply tx %d [%v]: %w", i, tx.Hash().Hex(), err)
+		}
+		statedb.Prepare(tx.Hash(), i)
+		receipt, err := applyTransaction(msg, p.config, gp, statedb, blockNumber, blockHash, tx, usedGas, vmenv)
+		if err != nil {
+			return nil, fmt.Errorf("could not apply tx %d [%v]: %w", i, tx.Hash().Hex(), err)
+		}
+		receipts = append(receipts, receipt)
+		allLogs = append(allLogs, receipt.Logs...)
+	}
+	// Credit the withdrawals of the beacon chain.
+	for _, w := range block.Withdrawals() {
+		amount := new(big.Int).SetUint64(w.Amount)
+		statedb.AddBalance(w.Address, amount.Mul(amount, gweiFactor))
+	}
+	return &ProcessResult{
+		Receipts:    receipts,
+		Logs:        allLogs,
+		GasUsed:     *usedGas,
+		Bloom:       types.CreateBloom(receipts),
+		TxRoot:      types.DeriveSha(block.Transactions(), trie.NewStackTrie(nil)),
+		ReceiptRoot: types.DeriveSha(receipts, trie.NewStackTrie(nil)),
+		Root:        statedb.IntermediateRoot(p.config.IsEIP158(blockNumber)),
+	}, nil
+}
+
+func applyTransaction(msg *Message, config *params.ChainConfig, gp *GasPool, statedb *state.StateDB, blockNumber *big.Int, blockHash common.Hash, tx *types.Transaction, usedGas *uint64, evm *vm.EVM) (*types.Receipt, error) {
+	// Create a new context to be used in the EVM environment.
+	evm.Reset(NewEVMTxContext(msg), statedb)
+
+	// Apply the transaction to the current state (included in the env).
+	result, err := ApplyMessage(evm, msg, gp)
+	if err != nil {
+		return nil, err
+	}
+	// Update the state with pending changes. Before Byzantium the receipt
+	// commits to the intermediate state root instead of a status code.
+	var root []byte
+	if config.IsByzantium(blockNumber) {
+		statedb.Finalise(true)
+	} else {
+		root = statedb.IntermediateRoot(config.IsEIP158(blockNumber)).Bytes()
+	}
+	*usedGas += result.UsedGas
+
+	receipt := NewReceipt(statedb, tx.Hash(), result.Failed(), result.UsedGas, *usedGas)
+	receipt.Type = tx.Type()
+	receipt.PostState = root
+
+	// If the transaction created a contract, store the creation address in the receipt.
+	if msg.To == nil {
+		receipt.ContractAddress = crypto.CreateAddress(evm.TxContext.Origin, tx.Nonce())
+	}
+	receipt.BlockHash = blockHash
+	receipt.BlockNumber = blockNumber
+	for _, log := range receipt.Logs {
+		log.BlockHash = blockHash
+		log.BlockNumber = blockNumber.Uint64()
+	}
+	return receipt, nil
+}
+
+// ValidateState validates the result of processing a block against the
+// commitments of its header: gas used, bloom, transaction, receipt and state
+// roots.
+func ValidateState(header *types.Header, result *ProcessResult) error {
+	if header.GasUsed != result.GasUsed {
+		return fmt.Errorf("invalid gas used (remote: %d local: %d)", header.GasUsed, result.GasUsed)
+	}
+	if header.Bloom != result.Bloom {
+		return fmt.Errorf("invalid bloom (remote: %x  local: %x)", header.Bloom, result.Bloom)
+	}
+	if header.TxHash != result.TxRoot {
+		return fmt.Errorf("transaction root hash mismatch (remote: %x local: %x)", header.TxHash, result.TxRoot)
+	}
+	if header.ReceiptHash != result.ReceiptRoot {
+		return fmt.Errorf("invalid receipt root hash (remote: %x local: %x)", header.ReceiptHash, result.ReceiptRoot)
+	}
+	if header.Root != result.Root {
+		return fmt.Errorf("invalid merkle root (remote: %x local: %x)", header.Root, result.Root)
+	}
+	return nil
+}
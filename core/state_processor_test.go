@@ -0,0 +1,145 @@
+package core
+
+import (
+	"crypto/ecdsa"
+	"errors"
+	"ethereum-evm/core/state"
+	"ethereum-evm/core/vm"
+	"ethereum-evm/ethdb/memorydb"
+	"ethereum-evm/params"
+	"ethereum-evm/trie"
+	"math/big"
+	"testing"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/crypto"
+)
+
+// newTestBlock signs txs with key and packs them in a London block mined by
+// the test coinbase. The header commitments are left for the caller to fill.
+func newTestBlock(t *testing.T, key *ecdsa.PrivateKey, txs []types.TxData) *types.Block {
+	signer := MakeSigner(params.TestChainConfig, big.NewInt(1))
+	var signed types.Transactions
+	for i, data := range txs {
+		tx, err := types.SignNewTx(key, signer, data)
+		if err != nil {
+			t.Fatalf("tx %d: failed to sign: %v", i, err)
+		}
+		signed = append(signed, tx)
+	}
+	header := &types.Header{
+		Number:     big.NewInt(1),
+		Coinbase:   testCoinbase,
+		GasLimit:   30000000,
+		Difficulty: big.NewInt(1),
+		BaseFee:    testBaseFee,
+	}
+	return types.NewBlockWithHeader(header).WithBody(signed, nil)
+}
+
+// newTestState creates an in-memory state in which addr owns one ether.
+func newTestState(addr common.Address) *state.StateDB {
+	statedb, _ := state.New(types.EmptyRootHash, state.NewDatabase(memorydb.New()))
+	statedb.SetBalance(addr, big.NewInt(ether))
+	return statedb
+}
+
+func TestStateProcessor(t *testing.T) {
+	var (
+		key, _  = crypto.GenerateKey()
+		from    = crypto.PubkeyToAddress(key.PublicKey)
+		to      = common.HexToAddress("0x2000")
+		feeCap  = new(big.Int).Mul(testBaseFee, big.NewInt(2))
+		chainID = params.TestChainConfig.ChainID
+		// PUSH1 0 PUSH1 0 LOG0 STOP: emits an empty log and deploys no code.
+		initCode = common.FromHex("60006000a000")
+	)
+	block := newTestBlock(t, key, []types.TxData{
+		&types.LegacyTx{Nonce: 0, To: &to, Value: big.NewInt(1), Gas: 21000, GasPrice: feeCap},
+		&types.DynamicFeeTx{ChainID: chainID, Nonce: 1, Gas: 100000, GasFeeCap: feeCap, GasTipCap: big.NewInt(gwei), Data: initCode},
+		&types.AccessListTx{ChainID: chainID, Nonce: 2, To: &to, Gas: 21000, GasPrice: feeCap},
+	})
+	processor := NewStateProcessor(params.TestChainConfig, nil)
+	result, err := processor.Process(block, newTestState(from), vm.Config{})
+	if err != nil {
+		t.Fatalf("failed to process block: %v", err)
+	}
+	if len(result.Receipts) != 3 {
+		t.Fatalf("receipt count mismatch: have %d, want 3", len(result.Receipts))
+	}
+	var cumulative uint64
+	for i, receipt := range result.Receipts {
+		tx := block.Transactions()[i]
+		cumulative += receipt.GasUsed
+		if receipt.CumulativeGasUsed != cumulative {
+			t.Errorf("receipt %d: cumulative gas mismatch: have %d, want %d", i, receipt.CumulativeGasUsed, cumulative)
+		}
+		if receipt.Status != types.ReceiptStatusSuccessful {
+			t.Errorf("receipt %d: transaction failed", i)
+		}
+		if receipt.Type != tx.Type() || receipt.TxHash != tx.Hash() || receipt.TransactionIndex != uint(i) {
+			t.Errorf("receipt %d: transaction fields mismatch", i)
+		}
+		if receipt.BlockHash != block.Hash() || receipt.BlockNumber.Cmp(block.Number()) != 0 {
+			t.Errorf("receipt %d: block fields mismatch", i)
+		}
+	}
+	if result.GasUsed != cumulative {
+		t.Errorf("gas used mismatch: have %d, want %d", result.GasUsed, cumulative)
+	}
+	create := result.Receipts[1]
+	if want := crypto.CreateAddress(from, 1); create.ContractAddress != want {
+		t.Errorf("contract address mismatch: have %x, want %x", create.ContractAddress, want)
+	}
+	if len(create.Logs) != 1 || len(result.Logs) != 1 {
+		t.Fatalf("log count mismatch: have %d in receipt, %d in block, want 1", len(create.Logs), len(result.Logs))
+	}
+	if log := create.Logs[0]; log.Address != create.ContractAddress || log.BlockNumber != 1 || log.BlockHash != block.Hash() || log.TxIndex != 1 {
+		t.Errorf("log fields mismatch: %+v", log)
+	}
+	if !types.BloomLookup(result.Bloom, create.ContractAddress) {
+		t.Errorf("contract address missing from bloom")
+	}
+	// Sealing a block with the computed commitments must make it valid, while
+	// the block without them is not.
+	if err := ValidateState(block.Header(), result); err == nil {
+		t.Errorf("unsealed block passed validation")
+	}
+	header := block.Header()
+	header.GasUsed = result.GasUsed
+	header.Root = result.Root
+	sealed := types.NewBlock(header, block.Transactions(), nil, result.Receipts, trie.NewStackTrie(nil))
+
+	result, err = processor.Process(sealed, newTestState(from), vm.Config{})
+	if err != nil {
+		t.Fatalf("failed to process sealed block: %v", err)
+	}
+	if err := ValidateState(sealed.Header(), result); err != nil {
+		t.Errorf("sealed block failed validation: %v", err)
+	}
+}
+
+func TestStateProcessorErrors(t *testing.T) {
+	var (
+		key, _ = crypto.GenerateKey()
+		from   = crypto.PubkeyToAddress(key.PublicKey)
+		to     = common.HexToAddress("0x2000")
+		feeCap = new(big.Int).Mul(testBaseFee, big.NewInt(2))
+	)
+	tests := []struct {
+		txs  []types.TxData
+		want error
+	}{
+		{[]types.TxData{&types.LegacyTx{Nonce: 1, To: &to, Gas: 21000, GasPrice: feeCap}}, ErrNonceTooHigh},
+		{[]types.TxData{&types.LegacyTx{To: &to, Gas: 21000, GasPrice: big.NewInt(1)}}, ErrFeeCapTooLow},
+		{[]types.TxData{&types.LegacyTx{To: &to, Gas: 30000001, GasPrice: feeCap}}, ErrGasLimitReached},
+	}
+	for i, tt := range tests {
+		block := newTestBlock(t, key, tt.txs)
+		_, err := NewStateProcessor(params.TestChainConfig, nil).Process(block, newTestState(from), vm.Config{})
+		if !errors.Is(err, tt.want) {
+			t.Errorf("test %d: error mismatch: have %v, want %v", i, err, tt.want)
+		}
+	}
+}
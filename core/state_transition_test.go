@@ -0,0 +1,196 @@
+package core
+
+import (
+	"errors"
+	"ethereum-evm/core/state"
+	"ethereum-evm/core/vm"
+	"ethereum-evm/ethdb/memorydb"
+	"ethereum-evm/params"
+	"math/big"
+	"testing"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core/types"
+)
+
+const (
+	gwei  = 1e9
+	ether = 1e18
+)
+
+var (
+	testSender   = common.HexToAddress("0x1000")
+	testCoinbase = common.HexToAddress("0xc0ffee")
+	testBaseFee  = big.NewInt(params.InitialBaseFee)
+)
+
+// newTestEVM creates a London EVM on top of a fresh in-memory state in which
+// the test sender owns one ether.
+func newTestEVM(msg *Message) (*vm.EVM, *state.StateDB) {
+	statedb, _ := state.New(types.EmptyRootHash, state.NewDatabase(memorydb.New()))
+	statedb.SetBalance(testSender, big.NewInt(ether))
+
+	blockCtx := vm.BlockContext{
+		CanTransfer: CanTransfer,
+		Transfer:    Transfer,
+		Coinbase:    testCoinbase,
+		GasLimit:    30000000,
+		BlockNumber: big.NewInt(1),
+		Time:        big.NewInt(0),
+		Difficulty:  big.NewInt(0),
+		BaseFee:     testBaseFee,
+	}
+	return vm.NewEVM(blockCtx, NewEVMTxContext(msg), statedb, params.TestChainConfig, vm.Config{}), statedb
+}
+
+// newTestMessage creates a 1559 style message from the test sender paying the
+// base fee plus a tip of one gwei.
+func newTestMessage(to *common.Address, value int64, data []byte) *Message {
+	tip := big.NewInt(gwei)
+	return &Message{
+		From:      testSender,
+		To:        to,
+		Value:     big.NewInt(value),
+		GasLimit:  100000,
+		GasPrice:  new(big.Int).Add(testBaseFee, tip),
+		GasFeeCap: new(big.Int).Mul(testBaseFee, big.NewInt(2)),
+		GasTipCap: tip,
+		Data:      data,
+	}
+}
+
+func TestApplyMessageTransfer(t *testing.T) {
+	to := common.HexToAddress("0x2000")
+	msg := newTestMessage(&to, 1000, nil)
+	evm, statedb := newTestEVM(msg)
+
+	gp := new(GasPool).AddGas(evm.Context.GasLimit)
+	result, err := ApplyMessage(evm, msg, gp)
+	if err != nil {
+		t.Fatalf("failed to apply message: %v", err)
+	}
+	if result.Failed() || result.UsedGas != params.TxGas {
+		t.Fatalf("unexpected result: used %d, err %v", result.UsedGas, result.Err)
+	}
+	if have := gp.Gas(); have != evm.Context.GasLimit-params.TxGas {
+		t.Errorf("gas pool mismatch: have %d, want %d", have, evm.Context.GasLimit-params.TxGas)
+	}
+	// The sender pays the value plus the gas at the effective price, the
+	// coinbase only receives the tip, the base fee is burnt.
+	fee := new(big.Int).Mul(big.NewInt(int64(params.TxGas)), msg.GasPrice)
+	want := new(big.Int).Sub(big.NewInt(ether), fee)
+	want.Sub(want, big.NewInt(1000))
+	if have := statedb.GetBalance(testSender); have.Cmp(want) != 0 {
+		t.Errorf("sender balance mismatch: have %v, want %v", have, want)
+	}
+	if have := statedb.GetBalance(to); have.Cmp(big.NewInt(1000)) != 0 {
+		t.Errorf("recipient balance mismatch: have %v, want 1000", have)
+	}
+	tip := new(big.Int).Mul(big.NewInt(int64(params.TxGas)), msg.GasTipCap)
+	if have := statedb.GetBalance(testCoinbase); have.Cmp(tip) != 0 {
+		t.Errorf("coinbase balance mismatch: have %v, want %v", have, tip)
+	}
+	if have := statedb.GetNonce(testSender); have != 1 {
+		t.Errorf("sender nonce mismatch: have %d, want 1", have)
+	}
+}
+
+func TestApplyMessageWithoutTime(t *testing.T) {
+	to := common.HexToAddress("0x2000")
+	msg := newTestMessage(&to, 1000, nil)
+	evm, statedb := newTestEVM(msg)
+	blockCtx := evm.Context
+	blockCtx.Time = nil
+	evm = vm.NewEVM(blockCtx, evm.TxContext, statedb, params.TestChainConfig, vm.Config{})
+
+	result, err := ApplyMessage(evm, msg, new(GasPool).AddGas(evm.Context.GasLimit))
+	if err != nil {
+		t.Fatalf("failed to apply message: %v", err)
+	}
+	if result.Failed() || result.UsedGas != params.TxGas {
+		t.Fatalf("unexpected result: used %d, err %v", result.UsedGas, result.Err)
+	}
+}
+
+func TestApplyMessageCreate(t *testing.T) {
+	// PUSH1 0x2a PUSH1 0 SSTORE: stores 42 at slot 0 of the new contract.
+	code := common.FromHex("602a600055")
+	msg := newTestMessage(nil, 0, code)
+	evm, statedb := newTestEVM(msg)
+
+	result, err := ApplyMessage(evm, msg, new(GasPool).AddGas(evm.Context.GasLimit))
+	if err != nil {
+		t.Fatalf("failed to apply message: %v", err)
+	}
+	if result.Failed() {
+		t.Fatalf("creation failed: %v", result.Err)
+	}
+	intrinsic, _ := IntrinsicGas(code, nil, true, true, true, false)
+	if result.UsedGas <= intrinsic {
+		t.Errorf("used gas %d does not cover intrinsic gas %d", result.UsedGas, intrinsic)
+	}
+	if have := statedb.GetNonce(testSender); have != 1 {
+		t.Errorf("sender nonce mismatch: have %d, want 1", have)
+	}
+}
+
+func TestApplyMessageErrors(t *testing.T) {
+	to := common.HexToAddress("0x2000")
+	tests := []struct {
+		name   string
+		modify func(msg *Message)
+		want   error
+	}{
+		{"nonce too high", func(msg *Message) { msg.Nonce = 1 }, ErrNonceTooHigh},
+		{"intrinsic gas", func(msg *Message) { msg.GasLimit = params.TxGas - 1 }, ErrIntrinsicGas},
+		{"insufficient funds", func(msg *Message) { msg.Value = big.NewInt(ether) }, ErrInsufficientFunds},
+		{"fee cap too low", func(msg *Message) {
+			msg.GasFeeCap = big.NewInt(1)
+			msg.GasTipCap = big.NewInt(1)
+		}, ErrFeeCapTooLow},
+		{"tip above fee cap", func(msg *Message) { msg.GasTipCap = new(big.Int).Add(msg.GasFeeCap, common.Big1) }, ErrTipAboveFeeCap},
+	}
+	for _, tt := range tests {
+		msg := newTestMessage(&to, 0, nil)
+		tt.modify(msg)
+		evm, statedb := newTestEVM(msg)
+		if _, err := ApplyMessage(evm, msg, new(GasPool).AddGas(evm.Context.GasLimit)); !errors.Is(err, tt.want) {
+			t.Errorf("%s: error mismatch: have %v, want %v", tt.name, err, tt.want)
+		}
+		if have := statedb.GetNonce(testSender); have != 0 {
+			t.Errorf("%s: nonce bumped by rejected message: %d", tt.name, have)
+		}
+	}
+	// A block without enough gas left rejects the message as well.
+	msg := newTestMessage(&to, 0, nil)
+	evm, _ := newTestEVM(msg)
+	if _, err := ApplyMessage(evm, msg, new(GasPool).AddGas(params.TxGas)); !errors.Is(err, ErrGasLimitReached) {
+		t.Errorf("gas pool: error mismatch: have %v, want %v", err, ErrGasLimitReached)
+	}
+}
+
+func TestIntrinsicGas(t *testing.T) {
+	data := []byte{0, 1, 0, 2}
+	list := types.AccessList{{Address: testSender, StorageKeys: []common.Hash{{}, {1}}}}
+
+	tests := []struct {
+		data     []byte
+		list     types.AccessList
+		creation bool
+		want     uint64
+	}{
+		{nil, nil, false, params.TxGas},
+		{nil, nil, true, params.TxGasContractCreation},
+		{data, nil, false, params.TxGas + 2*params.TxDataZeroGas + 2*params.TxDataNonZeroGasEIP2028},
+		{nil, list, false, params.TxGas + params.TxAccessListAddressGas + 2*params.TxAccessListStorageKeyGas},
+	}
+	for i, tt := range tests {
+		have, err := IntrinsicGas(tt.data, tt.list, tt.creation, true, true, false)
+		if err != nil {
+			t.Fatalf("test %d: unexpected error: %v", i, err)
+		}
+		if have != tt.want {
+			t.Errorf("test %d: intrinsic gas mismatch: have %d, want %d", i, have, tt.want)
+		}
+	}
+}
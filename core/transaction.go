@@ -0,0 +1,57 @@
+// Copyright 2016 The go-ethereum Authors
+// This file is part of the go-ethereum library.
+//
+// The go-ethereum library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-ethereum library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-ethereum library. If not, see <http://www.gnu.org/licenses/>.
+
+package core
+
+import (
+	"ethereum-evm/params"
+	"fmt"
+	"math/big"
+
+	"github.com/ethereum/go-ethereum/core/types"
+)
+
+// MakeSigner returns a Signer based on the given chain config and block number.
+// The signer recovers the sender of every transaction type valid at that block:
+// legacy transactions with or without EIP-155 replay protection, EIP-2930 access
+// list transactions and EIP-1559 dynamic fee transactions.
+func MakeSigner(config *params.ChainConfig, blockNumber *big.Int) types.Signer {
+	var signer types.Signer
+	switch {
+	case config.IsLondon(blockNumber):
+		signer = types.NewLondonSigner(config.ChainID)
+	case config.IsBerlin(blockNumber):
+		signer = types.NewEIP2930Signer(config.ChainID)
+	case config.IsEIP155(blockNumber):
+		signer = types.NewEIP155Signer(config.ChainID)
+	case config.IsHomestead(blockNumber):
+		signer = types.HomesteadSigner{}
+	default:
+		signer = types.FrontierSigner{}
+	}
+	return signer
+}
+
+// DecodeTransaction decodes a signed transaction in its canonical encoding: the
+// RLP list of a legacy transaction, or the type byte followed by the payload of
+// a typed (EIP-2718) transaction.
+func DecodeTransaction(raw []byte) (*types.Transaction, error) {
+	tx := new(types.Transaction)
+	if err := tx.UnmarshalBinary(raw); err != nil {
+		return nil, fmt.Errorf("invalid transaction: %w", err)
+	}
+	return tx, nil
+}
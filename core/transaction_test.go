@@ -0,0 +1,103 @@
+package core
+
+import (
+	"ethereum-evm/params"
+	"math/big"
+	"testing"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/crypto"
+)
+
+func TestMakeSigner(t *testing.T) {
+	config := params.MainnetChainConfig
+	tests := []struct {
+		number uint64
+		want   types.Signer
+	}{
+		{0, types.FrontierSigner{}},
+		{1_150_000, types.HomesteadSigner{}},
+		{2_675_000, types.NewEIP155Signer(config.ChainID)},
+		{12_244_000, types.NewEIP2930Signer(config.ChainID)},
+		{12_965_000, types.NewLondonSigner(config.ChainID)},
+	}
+	for _, tt := range tests {
+		if have := MakeSigner(config, new(big.Int).SetUint64(tt.number)); !have.Equal(tt.want) {
+			t.Errorf("block %d: signer mismatch: have %T, want %T", tt.number, have, tt.want)
+		}
+	}
+}
+
+// Tests that signed transactions of every envelope type survive encoding, have
+// their sender recovered and execute as messages.
+func TestApplySignedTransactions(t *testing.T) {
+	var (
+		key, _  = crypto.GenerateKey()
+		from    = crypto.PubkeyToAddress(key.PublicKey)
+		to      = common.HexToAddress("0x2000")
+		slot    = common.HexToHash("0x01")
+		signer  = MakeSigner(params.TestChainConfig, big.NewInt(1))
+		feeCap  = new(big.Int).Mul(testBaseFee, big.NewInt(2))
+		list    = types.AccessList{{Address: to, StorageKeys: []common.Hash{slot}}}
+		chainID = params.TestChainConfig.ChainID
+	)
+	txs := []types.TxData{
+		&types.LegacyTx{To: &to, Value: big.NewInt(1), Gas: 50000, GasPrice: feeCap},
+		&types.AccessListTx{ChainID: chainID, To: &to, Value: big.NewInt(1), Gas: 50000, GasPrice: feeCap, AccessList: list},
+		&types.DynamicFeeTx{ChainID: chainID, To: &to, Value: big.NewInt(1), Gas: 50000, GasFeeCap: feeCap, GasTipCap: big.NewInt(gwei), AccessList: list},
+	}
+	for i, data := range txs {
+		signed, err := types.SignNewTx(key, signer, data)
+		if err != nil {
+			t.Fatalf("tx %d: failed to sign: %v", i, err)
+		}
+		raw, err := signed.MarshalBinary()
+		if err != nil {
+			t.Fatalf("tx %d: failed to encode: %v", i, err)
+		}
+		tx, err := DecodeTransaction(raw)
+		if err != nil {
+			t.Fatalf("tx %d: failed to decode: %v", i, err)
+		}
+		if tx.Hash() != signed.Hash() || tx.Type() != signed.Type() {
+			t.Fatalf("tx %d: decoded transaction mismatch", i)
+		}
+		msg, err := TransactionToMessage(tx, signer, testBaseFee)
+		if err != nil {
+			t.Fatalf("tx %d: failed to recover sender: %v", i, err)
+		}
+		if msg.From != from {
+			t.Fatalf("tx %d: sender mismatch: have %x, want %x", i, msg.From, from)
+		}
+		// The effective gas price never exceeds the fee cap nor base fee plus tip.
+		if msg.GasPrice.Cmp(feeCap) > 0 {
+			t.Errorf("tx %d: gas price %v above fee cap %v", i, msg.GasPrice, feeCap)
+		}
+		evm, statedb := newTestEVM(msg)
+		statedb.SetBalance(from, big.NewInt(ether))
+
+		result, err := ApplyMessage(evm, msg, new(GasPool).AddGas(evm.Context.GasLimit))
+		if err != nil {
+			t.Fatalf("tx %d: failed to apply: %v", i, err)
+		}
+		want := params.TxGas
+		if tx.Type() != types.LegacyTxType {
+			want += params.TxAccessListAddressGas + params.TxAccessListStorageKeyGas
+		}
+		if result.Failed() || result.UsedGas != want {
+			t.Errorf("tx %d: unexpected result: used %d want %d, err %v", i, result.UsedGas, want, result.Err)
+		}
+		if _, warm := statedb.SlotInAccessList(to, slot); warm != (len(tx.AccessList()) > 0) {
+			t.Errorf("tx %d: access list slot warm %v, want %v", i, warm, len(tx.AccessList()) > 0)
+		}
+	}
+}
+
+func TestDecodeTransactionInvalid(t *testing.T) {
+	for i, raw := range [][]byte{nil, {0x7f}, {0x02, 0xc0}, {0xc3, 0x01, 0x02}} {
+		if _, err := DecodeTransaction(raw); err == nil {
+			t.Errorf("test %d: decoded invalid transaction %x", i, raw)
+		}
+	}
+}
@@ -0,0 +1,418 @@
+package vm
+
+import (
+	"bytes"
+	"math/big"
+	"testing"
+
+	"ethereum-evm/params"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/crypto"
+)
+
+// codeStateDB is a StateDB which only knows about contract code, nonces and
+// balances. Every other method panics through the embedded nil interface.
+type codeStateDB struct {
+	StateDB
+	code     map[common.Address][]byte
+	nonces   map[common.Address]uint64
+	balances map[common.Address]*big.Int
+	logs     []*types.Log
+}
+
+func (db *codeStateDB) AddLog(log *types.Log) { db.logs = append(db.logs, log) }
+
+// Snapshot and RevertToSnapshot only journal the logs, which is enough to
+// observe a reverted call frame.
+func (db *codeStateDB) Snapshot() int              { return len(db.logs) }
+func (db *codeStateDB) RevertToSnapshot(revid int) { db.logs = db.logs[:revid] }
+
+func (db *codeStateDB) GetNonce(addr common.Address) uint64 { return db.nonces[addr] }
+func (db *codeStateDB) SetNonce(addr common.Address, nonce uint64) {
+	if db.nonces == nil {
+		db.nonces = make(map[common.Address]uint64)
+	}
+	db.nonces[addr] = nonce
+}
+func (db *codeStateDB) CreateAccount(common.Address)             {}
+func (db *codeStateDB) SetCode(addr common.Address, code []byte) { db.code[addr] = code }
+
+func (db *codeStateDB) Exist(addr common.Address) bool {
+	_, ok := db.code[addr]
+	return ok
+}
+func (db *codeStateDB) GetCode(addr common.Address) []byte { return db.code[addr] }
+func (db *codeStateDB) GetCodeHash(addr common.Address) common.Hash {
+	return crypto.Keccak256Hash(db.code[addr])
+}
+
+func (db *codeStateDB) GetBalance(addr common.Address) *big.Int {
+	if balance, ok := db.balances[addr]; ok {
+		return balance
+	}
+	return new(big.Int)
+}
+func (db *codeStateDB) AddBalance(addr common.Address, amount *big.Int) {
+	if db.balances == nil {
+		db.balances = make(map[common.Address]*big.Int)
+	}
+	db.balances[addr] = new(big.Int).Add(db.GetBalance(addr), amount)
+}
+func (db *codeStateDB) SubBalance(addr common.Address, amount *big.Int) {
+	db.AddBalance(addr, new(big.Int).Neg(amount))
+}
+
+func canTransfer(db StateDB, addr common.Address, amount *big.Int) bool {
+	return db.GetBalance(addr).Cmp(amount) >= 0
+}
+
+func transfer(db StateDB, sender, recipient common.Address, amount *big.Int) {
+	db.SubBalance(sender, amount)
+	db.AddBalance(recipient, amount)
+}
+
+var (
+	byzantiumConfig = &params.ChainConfig{
+		ChainID:        big.NewInt(1),
+		HomesteadBlock: big.NewInt(0),
+		EIP150Block:    big.NewInt(0),
+		EIP155Block:    big.NewInt(0),
+		EIP158Block:    big.NewInt(0),
+		ByzantiumBlock: big.NewInt(0),
+	}
+	petersburgConfig = &params.ChainConfig{
+		ChainID:             big.NewInt(1),
+		HomesteadBlock:      big.NewInt(0),
+		EIP150Block:         big.NewInt(0),
+		EIP155Block:         big.NewInt(0),
+		EIP158Block:         big.NewInt(0),
+		ByzantiumBlock:      big.NewInt(0),
+		ConstantinopleBlock: big.NewInt(0),
+		PetersburgBlock:     big.NewInt(0),
+	}
+)
+
+// staticCaller returns code which STATICCALLs target, and returns the 32 bytes
+// of return data followed by the success flag.
+func staticCaller(target common.Address) []byte {
+	code := []byte{
+		byte(PUSH1), 0x20, // retSize
+		byte(PUSH1), 0x00, // retOffset
+		byte(PUSH1), 0x00, // inSize
+		byte(PUSH1), 0x00, // inOffset
+		byte(PUSH20),
+	}
+	code = append(code, target.Bytes()...)
+	return append(code,
+		byte(PUSH2), 0xff, 0xff, // gas
+		byte(STATICCALL),
+		byte(PUSH1), 0x20, byte(MSTORE),
+		byte(PUSH1), 0x40, byte(PUSH1), 0x00, byte(RETURN),
+	)
+}
+
+func TestStaticCall(t *testing.T) {
+	var (
+		caller  = common.HexToAddress("0xc0")
+		callee  = common.HexToAddress("0xaa")
+		returns = []byte{byte(PUSH1), 0x2a, byte(PUSH1), 0x00, byte(MSTORE), byte(PUSH1), 0x20, byte(PUSH1), 0x00, byte(RETURN)}
+		writes  = []byte{byte(PUSH1), 0x01, byte(PUSH1), 0x00, byte(SSTORE), byte(STOP)}
+	)
+	tests := []struct {
+		code    []byte
+		ret     byte
+		success byte
+	}{
+		{returns, 0x2a, 1},
+		{writes, 0x00, 0}, // write protection, the call fails
+	}
+	for i, tt := range tests {
+		statedb := &codeStateDB{code: map[common.Address][]byte{
+			caller: staticCaller(callee),
+			callee: tt.code,
+		}}
+		blockCtx := BlockContext{CanTransfer: canTransfer, Transfer: transfer, BlockNumber: new(big.Int), Time: new(big.Int)}
+		evm := NewEVM(blockCtx, TxContext{}, statedb, byzantiumConfig, Config{})
+		ret, _, err := evm.Call(AccountRef(common.Address{}), caller, nil, 100000, new(big.Int))
+		if err != nil {
+			t.Fatalf("test %d: unexpected error: %v", i, err)
+		}
+		want := make([]byte, 64)
+		want[31], want[63] = tt.ret, tt.success
+		if !bytes.Equal(ret, want) {
+			t.Errorf("test %d: return mismatch\nhave %x\nwant %x", i, ret, want)
+		}
+		if evm.depth != 0 {
+			t.Errorf("test %d: depth not restored: %d", i, evm.depth)
+		}
+	}
+}
+
+func TestCallDepthLimit(t *testing.T) {
+	statedb := &codeStateDB{code: map[common.Address][]byte{}}
+	blockCtx := BlockContext{CanTransfer: canTransfer, Transfer: transfer, BlockNumber: new(big.Int), Time: new(big.Int)}
+	evm := NewEVM(blockCtx, TxContext{}, statedb, byzantiumConfig, Config{})
+	evm.depth = int(params.CallCreateDepth) + 1
+	if _, gas, err := evm.Call(AccountRef(common.Address{}), common.Address{}, nil, 100, new(big.Int)); err != ErrDepth || gas != 100 {
+		t.Errorf("have gas %d, err %v; want 100, %v", gas, err, ErrDepth)
+	}
+}
+
+// creator returns code which deploys a contract returning the single byte 0x2a
+// using op (CREATE or CREATE2 with salt 1) and returns the new address.
+func creator(op OpCode) []byte {
+	// Init code: MSTORE8(0, 0x2a) RETURN(0, 1)
+	initcode := []byte{byte(PUSH1), 0x2a, byte(PUSH1), 0x00, byte(MSTORE8), byte(PUSH1), 0x01, byte(PUSH1), 0x00, byte(RETURN)}
+	code := []byte{byte(PUSH10)}
+	code = append(code, initcode...)
+	code = append(code, byte(PUSH1), 0x00, byte(MSTORE)) // initcode at memory[22:32]
+	if op == CREATE2 {
+		code = append(code, byte(PUSH1), 0x01) // salt
+	}
+	code = append(code,
+		byte(PUSH1), byte(len(initcode)), // size
+		byte(PUSH1), byte(32-len(initcode)), // offset
+		byte(PUSH1), 0x00, // value
+		byte(op),
+		byte(PUSH1), 0x00, byte(MSTORE),
+		byte(PUSH1), 0x20, byte(PUSH1), 0x00, byte(RETURN),
+	)
+	return code
+}
+
+func TestCreateOpcodes(t *testing.T) {
+	factory := common.HexToAddress("0xfa")
+	initcode := []byte{byte(PUSH1), 0x2a, byte(PUSH1), 0x00, byte(MSTORE8), byte(PUSH1), 0x01, byte(PUSH1), 0x00, byte(RETURN)}
+	var salt [32]byte
+	salt[31] = 1
+
+	tests := []struct {
+		op   OpCode
+		want common.Address
+	}{
+		{CREATE, crypto.CreateAddress(factory, 0)},
+		{CREATE2, crypto.CreateAddress2(factory, salt, crypto.Keccak256(initcode))},
+	}
+	for _, tt := range tests {
+		statedb := &codeStateDB{code: map[common.Address][]byte{factory: creator(tt.op)}}
+		blockCtx := BlockContext{CanTransfer: canTransfer, Transfer: transfer, BlockNumber: new(big.Int), Time: new(big.Int)}
+		evm := NewEVM(blockCtx, TxContext{}, statedb, petersburgConfig, Config{})
+		ret, _, err := evm.Call(AccountRef(common.Address{}), factory, nil, 1000000, new(big.Int))
+		if err != nil {
+			t.Fatalf("%v: unexpected error: %v", tt.op, err)
+		}
+		if have := common.BytesToAddress(ret); have != tt.want {
+			t.Errorf("%v: address mismatch: have %x, want %x", tt.op, have, tt.want)
+		}
+		if code := statedb.code[tt.want]; !bytes.Equal(code, []byte{0x2a}) {
+			t.Errorf("%v: deployed code mismatch: %x", tt.op, code)
+		}
+		if nonce := statedb.GetNonce(factory); nonce != 1 {
+			t.Errorf("%v: factory nonce %d, want 1", tt.op, nonce)
+		}
+	}
+}
+
+func TestLogOpcodes(t *testing.T) {
+	emitter := common.HexToAddress("0xe0")
+	// MSTORE(0, 0xff) LOG2(31, 1, topic0=0x01, topic1=0x02)
+	code := []byte{
+		byte(PUSH1), 0xff, byte(PUSH1), 0x00, byte(MSTORE),
+		byte(PUSH1), 0x02, byte(PUSH1), 0x01, // topics
+		byte(PUSH1), 0x01, byte(PUSH1), 0x1f, // size, offset
+		byte(LOG2), byte(STOP),
+	}
+	statedb := &codeStateDB{code: map[common.Address][]byte{emitter: code}}
+	blockCtx := BlockContext{CanTransfer: canTransfer, Transfer: transfer, BlockNumber: big.NewInt(7), Time: new(big.Int)}
+	evm := NewEVM(blockCtx, TxContext{}, statedb, byzantiumConfig, Config{})
+	if _, _, err := evm.Call(AccountRef(common.Address{}), emitter, nil, 100000, new(big.Int)); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(statedb.logs) != 1 {
+		t.Fatalf("have %d logs, want 1", len(statedb.logs))
+	}
+	log := statedb.logs[0]
+	if log.Address != emitter || log.BlockNumber != 7 || !bytes.Equal(log.Data, []byte{0xff}) {
+		t.Errorf("unexpected log: %+v", log)
+	}
+	if len(log.Topics) != 2 || log.Topics[0] != common.BigToHash(big.NewInt(1)) || log.Topics[1] != common.BigToHash(big.NewInt(2)) {
+		t.Errorf("unexpected topics: %v", log.Topics)
+	}
+}
+
+func TestLogOpcodesWithoutBlockNumber(t *testing.T) {
+	emitter := common.HexToAddress("0xe0")
+	// LOG0(0, 0) STOP
+	code := []byte{byte(PUSH1), 0x00, byte(PUSH1), 0x00, byte(LOG0), byte(STOP)}
+	statedb := &codeStateDB{code: map[common.Address][]byte{emitter: code}}
+	evm := NewEVM(BlockContext{CanTransfer: canTransfer, Transfer: transfer}, TxContext{}, statedb, byzantiumConfig, Config{})
+	if _, _, err := evm.Call(AccountRef(common.Address{}), emitter, nil, 100000, new(big.Int)); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(statedb.logs) != 1 || statedb.logs[0].BlockNumber != 0 {
+		t.Errorf("unexpected logs: %v", statedb.logs)
+	}
+}
+
+func TestBlockContextOpcodesWithoutBlockInfo(t *testing.T) {
+	contract := common.HexToAddress("0xaa")
+	// MSTORE(0, TIMESTAMP) MSTORE(32, NUMBER) MSTORE(64, DIFFICULTY) RETURN(0, 96)
+	code := []byte{
+		byte(TIMESTAMP), byte(PUSH1), 0x00, byte(MSTORE),
+		byte(NUMBER), byte(PUSH1), 0x20, byte(MSTORE),
+		byte(DIFFICULTY), byte(PUSH1), 0x40, byte(MSTORE),
+		byte(PUSH1), 0x60, byte(PUSH1), 0x00, byte(RETURN),
+	}
+	statedb := &codeStateDB{code: map[common.Address][]byte{contract: code}}
+	evm := NewEVM(BlockContext{CanTransfer: canTransfer, Transfer: transfer}, TxContext{}, statedb, byzantiumConfig, Config{})
+
+	ret, _, err := evm.Call(AccountRef(common.Address{}), contract, nil, 100000, new(big.Int))
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if !bytes.Equal(ret, make([]byte, 96)) {
+		t.Errorf("unexpected block information: %x", ret)
+	}
+}
+
+func TestRevertedCallDropsLogs(t *testing.T) {
+	var (
+		outer = common.HexToAddress("0xa0")
+		inner = common.HexToAddress("0xb0")
+	)
+	// LOG0(0, 0) REVERT(0, 0)
+	innerCode := []byte{
+		byte(PUSH1), 0x00, byte(PUSH1), 0x00, byte(LOG0),
+		byte(PUSH1), 0x00, byte(PUSH1), 0x00, byte(REVERT),
+	}
+	// LOG0(0, 0) CALL(inner) STOP
+	outerCode := []byte{
+		byte(PUSH1), 0x00, byte(PUSH1), 0x00, byte(LOG0),
+		byte(PUSH1), 0x00, byte(PUSH1), 0x00, // retSize, retOffset
+		byte(PUSH1), 0x00, byte(PUSH1), 0x00, // inSize, inOffset
+		byte(PUSH1), 0x00, // value
+		byte(PUSH20),
+	}
+	outerCode = append(outerCode, inner.Bytes()...)
+	outerCode = append(outerCode, byte(PUSH2), 0xff, 0xff, byte(CALL), byte(STOP))
+
+	statedb := &codeStateDB{code: map[common.Address][]byte{
+		outer: outerCode,
+		inner: innerCode,
+	}}
+	blockCtx := BlockContext{CanTransfer: canTransfer, Transfer: transfer, BlockNumber: new(big.Int), Time: new(big.Int)}
+	evm := NewEVM(blockCtx, TxContext{}, statedb, byzantiumConfig, Config{})
+	if _, _, err := evm.Call(AccountRef(common.Address{}), outer, nil, 200000, new(big.Int)); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(statedb.logs) != 1 || statedb.logs[0].Address != outer {
+		t.Fatalf("logs of the reverted frame were kept: %+v", statedb.logs)
+	}
+}
+
+func TestValueTransfer(t *testing.T) {
+	var (
+		sender = common.HexToAddress("0xc0")
+		payee  = common.HexToAddress("0xaa")
+		// MSTORE(0, BALANCE(ADDRESS)) RETURN(0, 32)
+		code = []byte{
+			byte(ADDRESS), byte(BALANCE), byte(PUSH1), 0x00, byte(MSTORE),
+			byte(PUSH1), 0x20, byte(PUSH1), 0x00, byte(RETURN),
+		}
+	)
+	statedb := &codeStateDB{
+		code:     map[common.Address][]byte{payee: code},
+		balances: map[common.Address]*big.Int{sender: big.NewInt(10)},
+	}
+	blockCtx := BlockContext{CanTransfer: canTransfer, Transfer: transfer, BlockNumber: new(big.Int), Time: new(big.Int)}
+	evm := NewEVM(blockCtx, TxContext{}, statedb, byzantiumConfig, Config{})
+
+	ret, _, err := evm.Call(AccountRef(sender), payee, nil, 100000, big.NewInt(3))
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if have := new(big.Int).SetBytes(ret); have.Cmp(big.NewInt(3)) != 0 {
+		t.Errorf("BALANCE inside the call: have %v, want 3", have)
+	}
+	if _, _, err := evm.Call(AccountRef(sender), payee, nil, 100000, big.NewInt(8)); err != ErrInsufficientBalance {
+		t.Errorf("overspending call: have error %v, want %v", err, ErrInsufficientBalance)
+	}
+	if _, _, _, err := evm.Create(AccountRef(sender), nil, 100000, big.NewInt(8)); err != ErrInsufficientBalance {
+		t.Errorf("overspending create: have error %v, want %v", err, ErrInsufficientBalance)
+	}
+	_, contract, _, err := evm.Create(AccountRef(sender), nil, 100000, big.NewInt(2))
+	if err != nil {
+		t.Fatalf("unexpected create error: %v", err)
+	}
+	for addr, want := range map[common.Address]int64{sender: 5, payee: 3, contract: 2} {
+		if have := statedb.GetBalance(addr); have.Cmp(big.NewInt(want)) != 0 {
+			t.Errorf("balance of %x: have %v, want %d", addr, have, want)
+		}
+	}
+}
+
+func TestTxContextOpcodes(t *testing.T) {
+	var (
+		origin   = common.HexToAddress("0x0a")
+		contract = common.HexToAddress("0xaa")
+		// MSTORE(0, ORIGIN) MSTORE(32, GASPRICE) RETURN(0, 64)
+		code = []byte{
+			byte(ORIGIN), byte(PUSH1), 0x00, byte(MSTORE),
+			byte(GASPRICE), byte(PUSH1), 0x20, byte(MSTORE),
+			byte(PUSH1), 0x40, byte(PUSH1), 0x00, byte(RETURN),
+		}
+	)
+	statedb := &codeStateDB{code: map[common.Address][]byte{contract: code}}
+	blockCtx := BlockContext{CanTransfer: canTransfer, Transfer: transfer, BlockNumber: new(big.Int), Time: new(big.Int)}
+	evm := NewEVM(blockCtx, TxContext{Origin: origin, GasPrice: big.NewInt(7)}, statedb, byzantiumConfig, Config{})
+
+	ret, _, err := evm.Call(AccountRef(common.HexToAddress("0xc0")), contract, nil, 100000, new(big.Int))
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if have := common.BytesToAddress(ret[:32]); have != origin {
+		t.Errorf("ORIGIN mismatch: have %x, want %x", have, origin)
+	}
+	if have := new(big.Int).SetBytes(ret[32:]); have.Cmp(big.NewInt(7)) != 0 {
+		t.Errorf("GASPRICE mismatch: have %v, want 7", have)
+	}
+}
+
+func TestBlockhashOpcode(t *testing.T) {
+	var (
+		contract = common.HexToAddress("0xaa")
+		// MSTORE(0, BLOCKHASH(CALLDATALOAD(0))) RETURN(0, 32)
+		code = []byte{
+			byte(PUSH1), 0x00, byte(CALLDATALOAD), byte(BLOCKHASH),
+			byte(PUSH1), 0x00, byte(MSTORE),
+			byte(PUSH1), 0x20, byte(PUSH1), 0x00, byte(RETURN),
+		}
+		getHash = func(n uint64) common.Hash { return common.BigToHash(new(big.Int).SetUint64(n + 1)) }
+	)
+	tests := []struct {
+		number uint64
+		want   common.Hash
+	}{
+		{43, common.Hash{}},      // Older than the last 256 blocks
+		{44, getHash(44)},        // Oldest available
+		{299, getHash(299)},      // Parent
+		{300, common.Hash{}},     // Current block
+		{1 << 40, common.Hash{}}, // Future block
+	}
+	statedb := &codeStateDB{code: map[common.Address][]byte{contract: code}}
+	blockCtx := BlockContext{CanTransfer: canTransfer, Transfer: transfer, GetHash: getHash, BlockNumber: big.NewInt(300), Time: new(big.Int)}
+	evm := NewEVM(blockCtx, TxContext{}, statedb, byzantiumConfig, Config{})
+
+	for i, tt := range tests {
+		input := common.BigToHash(new(big.Int).SetUint64(tt.number)).Bytes()
+		ret, _, err := evm.Call(AccountRef(common.HexToAddress("0xc0")), contract, input, 100000, new(big.Int))
+		if err != nil {
+			t.Fatalf("test %d: unexpected error: %v", i, err)
+		}
+		if have := common.BytesToHash(ret); have != tt.want {
+			t.Errorf("test %d: BLOCKHASH(%d) mismatch: have %x, want %x", i, tt.number, have, tt.want)
+		}
+	}
+}
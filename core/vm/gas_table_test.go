@@ -0,0 +1,141 @@
+// Copyright 2017 The go-ethereum Authors
+// This file is part of the go-ethereum library.
+//
+// The go-ethereum library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-ethereum library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-ethereum library. If not, see <http://www.gnu.org/licenses/>.
+
+package vm
+
+import (
+	"ethereum-evm/core/state"
+	"ethereum-evm/ethdb/memorydb"
+	"ethereum-evm/params"
+	"math/big"
+	"testing"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/holiman/uint256"
+)
+
+func TestMemoryGasCost(t *testing.T) {
+	tests := []struct {
+		size     uint64
+		cost     uint64
+		overflow bool
+	}{
+		{0x1fffffffe0, 36028809887088637, false},
+		{0x1fffffffe1, 0, true},
+	}
+	for i, tt := range tests {
+		v, err := memoryGasCost(&Memory{}, tt.size)
+		if (err == ErrGasUintOverflow) != tt.overflow {
+			t.Errorf("test %d: overflow mismatch: have %v, want %v", i, err == ErrGasUintOverflow, tt.overflow)
+		}
+		if v != tt.cost {
+			t.Errorf("test %d: gas cost mismatch: have %v, want %v", i, v, tt.cost)
+		}
+	}
+}
+
+func TestMemoryExpansionIsIncremental(t *testing.T) {
+	mem := NewMemory()
+	first, err := memoryGasCost(mem, 64)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if first != 6 { // 2 words * 3 + 4/512
+		t.Fatalf("first expansion cost mismatch: have %d, want 6", first)
+	}
+	mem.Resize(64)
+	if cost, _ := memoryGasCost(mem, 64); cost != 0 {
+		t.Fatalf("re-touching expanded memory should be free, have %d", cost)
+	}
+	if cost, _ := memoryGasCost(mem, 96); cost != 3 {
+		t.Fatalf("third word cost mismatch: have %d, want 3", cost)
+	}
+}
+
+func TestCallGas(t *testing.T) {
+	tests := []struct {
+		available, base uint64
+		requested       *uint256.Int
+		want            uint64
+	}{
+		// Requested gas below the 63/64 cap is forwarded as-is
+		{100000, 700, uint256.NewInt(1000), 1000},
+		// Requested gas above the cap is clamped to all but one 64th
+		{100000, 700, uint256.NewInt(1000000), 99300 - 99300/64},
+		// Requests overflowing 64 bits are clamped too
+		{100000, 0, new(uint256.Int).Lsh(uint256.NewInt(1), 100), 100000 - 100000/64},
+	}
+	for i, tt := range tests {
+		have, err := callGas(true, tt.available, tt.base, tt.requested)
+		if err != nil {
+			t.Fatalf("test %d: unexpected error: %v", i, err)
+		}
+		if have != tt.want {
+			t.Errorf("test %d: call gas mismatch: have %d, want %d", i, have, tt.want)
+		}
+	}
+}
+
+// TestSstoreGas runs SSTOREs against a slot holding a committed value and
+// checks the EIP-2929 gas and EIP-3529 refunds, which both depend on it.
+func TestSstoreGas(t *testing.T) {
+	tests := []struct {
+		original byte
+		code     string
+		used     uint64
+		refund   uint64
+	}{
+		// Fresh slot: cold access and a new value
+		{0, "6001600055", 6 + 2100 + 20000, 0},
+		// Same value: cold access and a no-op write
+		{1, "6001600055", 6 + 2100 + 100, 0},
+		// Overwrite: cold access and a reset
+		{1, "6002600055", 6 + 2100 + 2900, 0},
+		// Clear: cold access, a reset and the clearing refund
+		{1, "6000600055", 6 + 2100 + 2900, params.SstoreClearsScheduleRefundEIP3529},
+		// Clear and restore: the clearing refund is replaced by the restore one
+		{1, "60006000556001600055", 6 + 2100 + 2900 + 6 + 100, 5000 - 2100 - 100},
+	}
+	for i, tt := range tests {
+		address := common.BytesToAddress([]byte("contract"))
+		statedb, _ := state.New(types.EmptyRootHash, state.NewDatabase(memorydb.New()))
+		statedb.CreateAccount(address)
+		statedb.SetCode(address, common.FromHex(tt.code))
+		statedb.SetState(address, common.Hash{}, common.BytesToHash([]byte{tt.original}))
+		statedb.Finalise(true) // Push the state into the "original" slot
+
+		vmctx := BlockContext{
+			CanTransfer: canTransfer,
+			Transfer:    transfer,
+			BlockNumber: new(big.Int),
+			Time:        new(big.Int),
+		}
+		vmenv := NewEVM(vmctx, TxContext{}, statedb, params.AllEthashProtocolChanges, Config{})
+		statedb.AddAddressToAccessList(address)
+
+		_, gas, err := vmenv.Call(AccountRef(common.Address{}), address, nil, 100000, new(big.Int))
+		if err != nil {
+			t.Errorf("test %d: execution failed: %v", i, err)
+		}
+		if used := 100000 - gas; used != tt.used {
+			t.Errorf("test %d: gas used mismatch: have %v, want %v", i, used, tt.used)
+		}
+		if refund := statedb.GetRefund(); refund != tt.refund {
+			t.Errorf("test %d: gas refund mismatch: have %v, want %v", i, refund, tt.refund)
+		}
+	}
+}
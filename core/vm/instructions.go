@@ -17,9 +17,10 @@
 package vm
 
 import (
-	"fmt"
+	"ethereum-evm/params"
 
 	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core/types"
 
 	"github.com/holiman/uint256"
 	"golang.org/x/crypto/sha3"
@@ -260,14 +261,14 @@ func opAddress(pc *uint64, interpreter *EVMInterpreter, scope *ScopeContext) ([]
 }
 
 func opBalance(pc *uint64, interpreter *EVMInterpreter, scope *ScopeContext) ([]byte, error) {
-	// slot := scope.Stack.peek()
-	// address := common.Address(slot.Bytes20())
-	// slot.SetFromBig(interpreter.evm.StateDB.GetBalance(address))
+	slot := scope.Stack.peek()
+	address := common.Address(slot.Bytes20())
+	slot.SetFromBig(interpreter.evm.StateDB.GetBalance(address))
 	return nil, nil
 }
 
 func opOrigin(pc *uint64, interpreter *EVMInterpreter, scope *ScopeContext) ([]byte, error) {
-	// scope.Stack.push(new(uint256.Int).SetBytes(interpreter.evm.Origin.Bytes()))
+	scope.Stack.push(new(uint256.Int).SetBytes(interpreter.evm.Origin.Bytes()))
 	return nil, nil
 }
 func opCaller(pc *uint64, interpreter *EVMInterpreter, scope *ScopeContext) ([]byte, error) {
@@ -285,7 +286,6 @@ func opCallDataLoad(pc *uint64, interpreter *EVMInterpreter, scope *ScopeContext
 	x := scope.Stack.peek()
 	if offset, overflow := x.Uint64WithOverflow(); !overflow {
 		data := getData(scope.Contract.Input, offset, 32)
-		fmt.Println("@@##opCallDataLoad data: ", data)
 		x.SetBytes(data)
 	} else {
 		x.Clear()
@@ -294,7 +294,6 @@ func opCallDataLoad(pc *uint64, interpreter *EVMInterpreter, scope *ScopeContext
 }
 
 func opCallDataSize(pc *uint64, interpreter *EVMInterpreter, scope *ScopeContext) ([]byte, error) {
-	fmt.Println("@@##opCallDataSize Contract.Input: ", scope.Contract.Input)
 	scope.Stack.push(new(uint256.Int).SetUint64(uint64(len(scope.Contract.Input))))
 	return nil, nil
 }
@@ -430,58 +429,68 @@ func opExtCodeHash(pc *uint64, interpreter *EVMInterpreter, scope *ScopeContext)
 }
 
 func opGasprice(pc *uint64, interpreter *EVMInterpreter, scope *ScopeContext) ([]byte, error) {
-	// v, _ := uint256.FromBig(interpreter.evm.GasPrice)
-	// scope.Stack.push(v)
+	v, _ := uint256.FromBig(interpreter.evm.GasPrice)
+	scope.Stack.push(v)
 	return nil, nil
 }
 
 func opBlockhash(pc *uint64, interpreter *EVMInterpreter, scope *ScopeContext) ([]byte, error) {
-	// num := scope.Stack.peek()
-	// num64, overflow := num.Uint64WithOverflow()
-	// if overflow {
-	// 	num.Clear()
-	// 	return nil, nil
-	// }
-	// var upper, lower uint64
-	// upper = interpreter.evm.Context.BlockNumber.Uint64()
-	// if upper < 257 {
-	// 	lower = 0
-	// } else {
-	// 	lower = upper - 256
-	// }
-	// if num64 >= lower && num64 < upper {
-	// 	num.SetBytes(interpreter.evm.Context.GetHash(num64).Bytes())
-	// } else {
-	// 	num.Clear()
-	// }
+	num := scope.Stack.peek()
+	num64, overflow := num.Uint64WithOverflow()
+	// Bare runs without a chain have no block hashes to serve.
+	if overflow || interpreter.evm.Context.GetHash == nil {
+		num.Clear()
+		return nil, nil
+	}
+	var upper, lower uint64
+	upper = interpreter.evm.Context.BlockNumber.Uint64()
+	if upper < 257 {
+		lower = 0
+	} else {
+		lower = upper - 256
+	}
+	if num64 >= lower && num64 < upper {
+		num.SetBytes(interpreter.evm.Context.GetHash(num64).Bytes())
+	} else {
+		num.Clear()
+	}
 	return nil, nil
 }
 
 func opCoinbase(pc *uint64, interpreter *EVMInterpreter, scope *ScopeContext) ([]byte, error) {
-	// scope.Stack.push(new(uint256.Int).SetBytes(interpreter.evm.Context.Coinbase.Bytes()))
+	scope.Stack.push(new(uint256.Int).SetBytes(interpreter.evm.Context.Coinbase.Bytes()))
 	return nil, nil
 }
 
 func opTimestamp(pc *uint64, interpreter *EVMInterpreter, scope *ScopeContext) ([]byte, error) {
-	// v, _ := uint256.FromBig(interpreter.evm.Context.Time)
-	// scope.Stack.push(v)
+	v, _ := uint256.FromBig(interpreter.evm.Context.Time)
+	scope.Stack.push(v)
 	return nil, nil
 }
 
 func opNumber(pc *uint64, interpreter *EVMInterpreter, scope *ScopeContext) ([]byte, error) {
-	// v, _ := uint256.FromBig(interpreter.evm.Context.BlockNumber)
-	// scope.Stack.push(v)
+	v, _ := uint256.FromBig(interpreter.evm.Context.BlockNumber)
+	scope.Stack.push(v)
 	return nil, nil
 }
 
 func opDifficulty(pc *uint64, interpreter *EVMInterpreter, scope *ScopeContext) ([]byte, error) {
-	// v, _ := uint256.FromBig(interpreter.evm.Context.Difficulty)
-	// scope.Stack.push(v)
+	v, _ := uint256.FromBig(interpreter.evm.Context.Difficulty)
+	scope.Stack.push(v)
+	return nil, nil
+}
+
+func opRandom(pc *uint64, interpreter *EVMInterpreter, scope *ScopeContext) ([]byte, error) {
+	v := new(uint256.Int)
+	if random := interpreter.evm.Context.Random; random != nil {
+		v.SetBytes(random.Bytes())
+	}
+	scope.Stack.push(v)
 	return nil, nil
 }
 
 func opGasLimit(pc *uint64, interpreter *EVMInterpreter, scope *ScopeContext) ([]byte, error) {
-	// scope.Stack.push(new(uint256.Int).SetUint64(interpreter.evm.Context.GasLimit))
+	scope.Stack.push(new(uint256.Int).SetUint64(interpreter.evm.Context.GasLimit))
 	return nil, nil
 }
 
@@ -511,12 +520,8 @@ func opMstore8(pc *uint64, interpreter *EVMInterpreter, scope *ScopeContext) ([]
 }
 
 func opSload(pc *uint64, interpreter *EVMInterpreter, scope *ScopeContext) ([]byte, error) {
-	fmt.Println("#####################################opSload###########################################")
 	loc := scope.Stack.peek()
 	hash := common.Hash(loc.Bytes32())
-	fmt.Printf("###opSload loc==> %x\n", loc)
-	fmt.Printf("###opSload hash==> %x\n", hash)
-	fmt.Printf("###opSload contract addr==> %x\n", scope.Contract.Address())
 	val := interpreter.evm.StateDB.GetState(scope.Contract.Address(), hash)
 	loc.SetBytes(val.Bytes())
 
@@ -575,215 +580,209 @@ func opGas(pc *uint64, interpreter *EVMInterpreter, scope *ScopeContext) ([]byte
 }
 
 func opCreate(pc *uint64, interpreter *EVMInterpreter, scope *ScopeContext) ([]byte, error) {
-	// var (
-	// 	value        = scope.Stack.pop()
-	// 	offset, size = scope.Stack.pop(), scope.Stack.pop()
-	// 	input        = scope.Memory.GetCopy(int64(offset.Uint64()), int64(size.Uint64()))
-	// 	gas          = scope.Contract.Gas
-	// )
-	// if interpreter.evm.chainRules.IsEIP150 {
-	// 	gas -= gas / 64
-	// }
-	// // reuse size int for stackvalue
-	// stackvalue := size
-
-	// scope.Contract.UseGas(gas)
-	// //TODO: use uint256.Int instead of converting with toBig()
-	// var bigVal = big0
-	// if !value.IsZero() {
-	// 	bigVal = value.ToBig()
-	// }
+	var (
+		value        = scope.Stack.pop()
+		offset, size = scope.Stack.pop(), scope.Stack.pop()
+		input        = scope.Memory.GetCopy(int64(offset.Uint64()), int64(size.Uint64()))
+		gas          = scope.Contract.Gas
+	)
+	if interpreter.evm.chainRules.IsEIP150 {
+		gas -= gas / 64
+	}
+	// reuse size int for stackvalue
+	stackvalue := size
+
+	scope.Contract.UseGas(gas)
+	//TODO: use uint256.Int instead of converting with toBig()
+	var bigVal = big0
+	if !value.IsZero() {
+		bigVal = value.ToBig()
+	}
 
-	// res, addr, returnGas, suberr := interpreter.evm.Create(scope.Contract, input, gas, bigVal)
-	// // Push item on the stack based on the returned error. If the ruleset is
-	// // homestead we must check for CodeStoreOutOfGasError (homestead only
-	// // rule) and treat as an error, if the ruleset is frontier we must
-	// // ignore this error and pretend the operation was successful.
-	// if interpreter.evm.chainRules.IsHomestead && suberr == ErrCodeStoreOutOfGas {
-	// 	stackvalue.Clear()
-	// } else if suberr != nil && suberr != ErrCodeStoreOutOfGas {
-	// 	stackvalue.Clear()
-	// } else {
-	// 	stackvalue.SetBytes(addr.Bytes())
-	// }
-	// scope.Stack.push(&stackvalue)
-	// scope.Contract.Gas += returnGas
+	res, addr, returnGas, suberr := interpreter.evm.Create(scope.Contract, input, gas, bigVal)
+	// Push item on the stack based on the returned error. If the ruleset is
+	// homestead we must check for CodeStoreOutOfGasError (homestead only
+	// rule) and treat as an error, if the ruleset is frontier we must
+	// ignore this error and pretend the operation was successful.
+	if interpreter.evm.chainRules.IsHomestead && suberr == ErrCodeStoreOutOfGas {
+		stackvalue.Clear()
+	} else if suberr != nil && suberr != ErrCodeStoreOutOfGas {
+		stackvalue.Clear()
+	} else {
+		stackvalue.SetBytes(addr.Bytes())
+	}
+	scope.Stack.push(&stackvalue)
+	scope.Contract.Gas += returnGas
 
-	// if suberr == ErrExecutionReverted {
-	// 	return res, nil
-	// }
+	if suberr == ErrExecutionReverted {
+		return res, nil
+	}
 	return nil, nil
 }
 
 func opCreate2(pc *uint64, interpreter *EVMInterpreter, scope *ScopeContext) ([]byte, error) {
-	// var (
-	// 	endowment    = scope.Stack.pop()
-	// 	offset, size = scope.Stack.pop(), scope.Stack.pop()
-	// 	salt         = scope.Stack.pop()
-	// 	input        = scope.Memory.GetCopy(int64(offset.Uint64()), int64(size.Uint64()))
-	// 	gas          = scope.Contract.Gas
-	// )
+	var (
+		endowment    = scope.Stack.pop()
+		offset, size = scope.Stack.pop(), scope.Stack.pop()
+		salt         = scope.Stack.pop()
+		input        = scope.Memory.GetCopy(int64(offset.Uint64()), int64(size.Uint64()))
+		gas          = scope.Contract.Gas
+	)
 
-	// // Apply EIP150
-	// gas -= gas / 64
-	// scope.Contract.UseGas(gas)
-	// // reuse size int for stackvalue
-	// stackvalue := size
-	// //TODO: use uint256.Int instead of converting with toBig()
-	// bigEndowment := big0
-	// if !endowment.IsZero() {
-	// 	bigEndowment = endowment.ToBig()
-	// }
-	// res, addr, returnGas, suberr := interpreter.evm.Create2(scope.Contract, input, gas,
-	// 	bigEndowment, &salt)
-	// // Push item on the stack based on the returned error.
-	// if suberr != nil {
-	// 	stackvalue.Clear()
-	// } else {
-	// 	stackvalue.SetBytes(addr.Bytes())
-	// }
-	// scope.Stack.push(&stackvalue)
-	// scope.Contract.Gas += returnGas
+	// Apply EIP150
+	gas -= gas / 64
+	scope.Contract.UseGas(gas)
+	// reuse size int for stackvalue
+	stackvalue := size
+	//TODO: use uint256.Int instead of converting with toBig()
+	bigEndowment := big0
+	if !endowment.IsZero() {
+		bigEndowment = endowment.ToBig()
+	}
+	res, addr, returnGas, suberr := interpreter.evm.Create2(scope.Contract, input, gas,
+		bigEndowment, &salt)
+	// Push item on the stack based on the returned error.
+	if suberr != nil {
+		stackvalue.Clear()
+	} else {
+		stackvalue.SetBytes(addr.Bytes())
+	}
+	scope.Stack.push(&stackvalue)
+	scope.Contract.Gas += returnGas
 
-	// if suberr == ErrExecutionReverted {
-	// 	return res, nil
-	// }
+	if suberr == ErrExecutionReverted {
+		return res, nil
+	}
 	return nil, nil
 }
 
 func opCall(pc *uint64, interpreter *EVMInterpreter, scope *ScopeContext) ([]byte, error) {
-	// stack := scope.Stack
-	// // Pop gas. The actual gas in interpreter.evm.callGasTemp.
-	// // We can use this as a temporary value
-	// temp := stack.pop()
-	// gas := interpreter.evm.callGasTemp
-	// // Pop other call parameters.
-	// addr, value, inOffset, inSize, retOffset, retSize := stack.pop(), stack.pop(), stack.pop(), stack.pop(), stack.pop(), stack.pop()
-	// toAddr := common.Address(addr.Bytes20())
-	// // Get the arguments from the memory.
-	// args := scope.Memory.GetPtr(int64(inOffset.Uint64()), int64(inSize.Uint64()))
-
-	// var bigVal = big0
-	// //TODO: use uint256.Int instead of converting with toBig()
-	// // By using big0 here, we save an alloc for the most common case (non-ether-transferring contract calls),
-	// // but it would make more sense to extend the usage of uint256.Int
-	// if !value.IsZero() {
-	// 	gas += params.CallStipend
-	// 	bigVal = value.ToBig()
-	// }
+	stack := scope.Stack
+	// Pop gas. The actual gas in interpreter.evm.callGasTemp.
+	// We can use this as a temporary value
+	temp := stack.pop()
+	gas := interpreter.evm.callGasTemp
+	// Pop other call parameters.
+	addr, value, inOffset, inSize, retOffset, retSize := stack.pop(), stack.pop(), stack.pop(), stack.pop(), stack.pop(), stack.pop()
+	toAddr := common.Address(addr.Bytes20())
+	// Get the arguments from the memory.
+	args := scope.Memory.GetPtr(int64(inOffset.Uint64()), int64(inSize.Uint64()))
+
+	var bigVal = big0
+	//TODO: use uint256.Int instead of converting with toBig()
+	// By using big0 here, we save an alloc for the most common case (non-ether-transferring contract calls),
+	// but it would make more sense to extend the usage of uint256.Int
+	if !value.IsZero() {
+		gas += params.CallStipend
+		bigVal = value.ToBig()
+	}
 
-	// ret, returnGas, err := interpreter.evm.Call(scope.Contract, toAddr, args, gas, bigVal)
+	ret, returnGas, err := interpreter.evm.Call(scope.Contract, toAddr, args, gas, bigVal)
 
-	// if err != nil {
-	// 	temp.Clear()
-	// } else {
-	// 	temp.SetOne()
-	// }
-	// stack.push(&temp)
-	// if err == nil || err == ErrExecutionReverted {
-	// 	ret = common.CopyBytes(ret)
-	// 	scope.Memory.Set(retOffset.Uint64(), retSize.Uint64(), ret)
-	// }
-	// scope.Contract.Gas += returnGas
+	if err != nil {
+		temp.Clear()
+	} else {
+		temp.SetOne()
+	}
+	stack.push(&temp)
+	if err == nil || err == ErrExecutionReverted {
+		ret = common.CopyBytes(ret)
+		scope.Memory.Set(retOffset.Uint64(), retSize.Uint64(), ret)
+	}
+	scope.Contract.Gas += returnGas
 
-	// return ret, nil
-	return nil, nil
+	return ret, nil
 }
 
 func opCallCode(pc *uint64, interpreter *EVMInterpreter, scope *ScopeContext) ([]byte, error) {
-	// // Pop gas. The actual gas is in interpreter.evm.callGasTemp.
-	// stack := scope.Stack
-	// // We use it as a temporary value
-	// temp := stack.pop()
-	// gas := interpreter.evm.callGasTemp
-	// // Pop other call parameters.
-	// addr, value, inOffset, inSize, retOffset, retSize := stack.pop(), stack.pop(), stack.pop(), stack.pop(), stack.pop(), stack.pop()
-	// toAddr := common.Address(addr.Bytes20())
-	// // Get arguments from the memory.
-	// args := scope.Memory.GetPtr(int64(inOffset.Uint64()), int64(inSize.Uint64()))
-
-	// //TODO: use uint256.Int instead of converting with toBig()
-	// var bigVal = big0
-	// if !value.IsZero() {
-	// 	gas += params.CallStipend
-	// 	bigVal = value.ToBig()
-	// }
-
-	// ret, returnGas, err := interpreter.evm.CallCode(scope.Contract, toAddr, args, gas, bigVal)
-	// if err != nil {
-	// 	temp.Clear()
-	// } else {
-	// 	temp.SetOne()
-	// }
-	// stack.push(&temp)
-	// if err == nil || err == ErrExecutionReverted {
-	// 	ret = common.CopyBytes(ret)
-	// 	scope.Memory.Set(retOffset.Uint64(), retSize.Uint64(), ret)
-	// }
-	// scope.Contract.Gas += returnGas
+	// Pop gas. The actual gas is in interpreter.evm.callGasTemp.
+	stack := scope.Stack
+	// We use it as a temporary value
+	temp := stack.pop()
+	gas := interpreter.evm.callGasTemp
+	// Pop other call parameters.
+	addr, value, inOffset, inSize, retOffset, retSize := stack.pop(), stack.pop(), stack.pop(), stack.pop(), stack.pop(), stack.pop()
+	toAddr := common.Address(addr.Bytes20())
+	// Get arguments from the memory.
+	args := scope.Memory.GetPtr(int64(inOffset.Uint64()), int64(inSize.Uint64()))
+
+	//TODO: use uint256.Int instead of converting with toBig()
+	var bigVal = big0
+	if !value.IsZero() {
+		gas += params.CallStipend
+		bigVal = value.ToBig()
+	}
 
-	// return ret, nil
+	ret, returnGas, err := interpreter.evm.CallCode(scope.Contract, toAddr, args, gas, bigVal)
+	if err != nil {
+		temp.Clear()
+	} else {
+		temp.SetOne()
+	}
+	stack.push(&temp)
+	if err == nil || err == ErrExecutionReverted {
+		ret = common.CopyBytes(ret)
+		scope.Memory.Set(retOffset.Uint64(), retSize.Uint64(), ret)
+	}
+	scope.Contract.Gas += returnGas
 
-	return nil, nil
+	return ret, nil
 }
 
 func opDelegateCall(pc *uint64, interpreter *EVMInterpreter, scope *ScopeContext) ([]byte, error) {
-	// stack := scope.Stack
-	// // Pop gas. The actual gas is in interpreter.evm.callGasTemp.
-	// // We use it as a temporary value
-	// temp := stack.pop()
-	// gas := interpreter.evm.callGasTemp
-	// // Pop other call parameters.
-	// addr, inOffset, inSize, retOffset, retSize := stack.pop(), stack.pop(), stack.pop(), stack.pop(), stack.pop()
-	// toAddr := common.Address(addr.Bytes20())
-	// // Get arguments from the memory.
-	// args := scope.Memory.GetPtr(int64(inOffset.Uint64()), int64(inSize.Uint64()))
-
-	// ret, returnGas, err := interpreter.evm.DelegateCall(scope.Contract, toAddr, args, gas)
-	// if err != nil {
-	// 	temp.Clear()
-	// } else {
-	// 	temp.SetOne()
-	// }
-	// stack.push(&temp)
-	// if err == nil || err == ErrExecutionReverted {
-	// 	ret = common.CopyBytes(ret)
-	// 	scope.Memory.Set(retOffset.Uint64(), retSize.Uint64(), ret)
-	// }
-	// scope.Contract.Gas += returnGas
-
-	// return ret, nil
+	stack := scope.Stack
+	// Pop gas. The actual gas is in interpreter.evm.callGasTemp.
+	// We use it as a temporary value
+	temp := stack.pop()
+	gas := interpreter.evm.callGasTemp
+	// Pop other call parameters.
+	addr, inOffset, inSize, retOffset, retSize := stack.pop(), stack.pop(), stack.pop(), stack.pop(), stack.pop()
+	toAddr := common.Address(addr.Bytes20())
+	// Get arguments from the memory.
+	args := scope.Memory.GetPtr(int64(inOffset.Uint64()), int64(inSize.Uint64()))
+
+	ret, returnGas, err := interpreter.evm.DelegateCall(scope.Contract, toAddr, args, gas)
+	if err != nil {
+		temp.Clear()
+	} else {
+		temp.SetOne()
+	}
+	stack.push(&temp)
+	if err == nil || err == ErrExecutionReverted {
+		ret = common.CopyBytes(ret)
+		scope.Memory.Set(retOffset.Uint64(), retSize.Uint64(), ret)
+	}
+	scope.Contract.Gas += returnGas
 
-	return nil, nil
+	return ret, nil
 }
 
 func opStaticCall(pc *uint64, interpreter *EVMInterpreter, scope *ScopeContext) ([]byte, error) {
-	// // Pop gas. The actual gas is in interpreter.evm.callGasTemp.
-	// stack := scope.Stack
-	// // We use it as a temporary value
-	// temp := stack.pop()
-	// gas := interpreter.evm.callGasTemp
-	// // Pop other call parameters.
-	// addr, inOffset, inSize, retOffset, retSize := stack.pop(), stack.pop(), stack.pop(), stack.pop(), stack.pop()
-	// toAddr := common.Address(addr.Bytes20())
-	// // Get arguments from the memory.
-	// args := scope.Memory.GetPtr(int64(inOffset.Uint64()), int64(inSize.Uint64()))
-
-	// ret, returnGas, err := interpreter.evm.StaticCall(scope.Contract, toAddr, args, gas)
-	// if err != nil {
-	// 	temp.Clear()
-	// } else {
-	// 	temp.SetOne()
-	// }
-	// stack.push(&temp)
-	// if err == nil || err == ErrExecutionReverted {
-	// 	ret = common.CopyBytes(ret)
-	// 	scope.Memory.Set(retOffset.Uint64(), retSize.Uint64(), ret)
-	// }
-	// scope.Contract.Gas += returnGas
+	// Pop gas. The actual gas is in interpreter.evm.callGasTemp.
+	stack := scope.Stack
+	// We use it as a temporary value
+	temp := stack.pop()
+	gas := interpreter.evm.callGasTemp
+	// Pop other call parameters.
+	addr, inOffset, inSize, retOffset, retSize := stack.pop(), stack.pop(), stack.pop(), stack.pop(), stack.pop()
+	toAddr := common.Address(addr.Bytes20())
+	// Get arguments from the memory.
+	args := scope.Memory.GetPtr(int64(inOffset.Uint64()), int64(inSize.Uint64()))
+
+	ret, returnGas, err := interpreter.evm.StaticCall(scope.Contract, toAddr, args, gas)
+	if err != nil {
+		temp.Clear()
+	} else {
+		temp.SetOne()
+	}
+	stack.push(&temp)
+	if err == nil || err == ErrExecutionReverted {
+		ret = common.CopyBytes(ret)
+		scope.Memory.Set(retOffset.Uint64(), retSize.Uint64(), ret)
+	}
+	scope.Contract.Gas += returnGas
 
-	// return ret, nil
-	return nil, nil
+	return ret, nil
 }
 
 func opReturn(pc *uint64, interpreter *EVMInterpreter, scope *ScopeContext) ([]byte, error) {
@@ -805,10 +804,14 @@ func opStop(pc *uint64, interpreter *EVMInterpreter, scope *ScopeContext) ([]byt
 }
 
 func opSuicide(pc *uint64, interpreter *EVMInterpreter, scope *ScopeContext) ([]byte, error) {
-	// beneficiary := scope.Stack.pop()
-	// balance := interpreter.evm.StateDB.GetBalance(scope.Contract.Address())
-	// interpreter.evm.StateDB.AddBalance(beneficiary.Bytes20(), balance)
-	// interpreter.evm.StateDB.Suicide(scope.Contract.Address())
+	beneficiary := scope.Stack.pop()
+	balance := interpreter.evm.StateDB.GetBalance(scope.Contract.Address())
+	interpreter.evm.StateDB.AddBalance(beneficiary.Bytes20(), balance)
+	interpreter.evm.StateDB.Suicide(scope.Contract.Address())
+	if interpreter.evm.Config.Debug {
+		interpreter.evm.Config.Tracer.CaptureEnter(SELFDESTRUCT, scope.Contract.Address(), beneficiary.Bytes20(), []byte{}, 0, balance)
+		interpreter.evm.Config.Tracer.CaptureExit([]byte{}, 0, nil)
+	}
 	return nil, nil
 }
 
@@ -817,24 +820,23 @@ func opSuicide(pc *uint64, interpreter *EVMInterpreter, scope *ScopeContext) ([]
 // make log instruction function
 func makeLog(size int) executionFunc {
 	return func(pc *uint64, interpreter *EVMInterpreter, scope *ScopeContext) ([]byte, error) {
-		// topics := make([]common.Hash, size)
-		// stack := scope.Stack
-		// mStart, mSize := stack.pop(), stack.pop()
-		// for i := 0; i < size; i++ {
-		// 	addr := stack.pop()
-		// 	topics[i] = addr.Bytes32()
-		// }
-
-		// d := scope.Memory.GetCopy(int64(mStart.Uint64()), int64(mSize.Uint64()))
-		// interpreter.evm.StateDB.AddLog(&types.Log{
-		// 	Address: scope.Contract.Address(),
-		// 	Topics:  topics,
-		// 	Data:    d,
-		// 	// This is a non-consensus field, but assigned here because
-		// 	// core/state doesn't know the current block number.
-		// 	BlockNumber: interpreter.evm.Context.BlockNumber.Uint64(),
-		// })
+		topics := make([]common.Hash, size)
+		stack := scope.Stack
+		mStart, mSize := stack.pop(), stack.pop()
+		for i := 0; i < size; i++ {
+			addr := stack.pop()
+			topics[i] = addr.Bytes32()
+		}
 
+		d := scope.Memory.GetCopy(int64(mStart.Uint64()), int64(mSize.Uint64()))
+		// This is a non-consensus field, but assigned here because
+		// core/state doesn't know the current block number.
+		interpreter.evm.StateDB.AddLog(&types.Log{
+			Address:     scope.Contract.Address(),
+			Topics:      topics,
+			Data:        d,
+			BlockNumber: interpreter.evm.Context.BlockNumber.Uint64(),
+		})
 		return nil, nil
 	}
 }
@@ -1,29 +1,29 @@
 package vm
 
 import (
-	"bufio"
 	"encoding/hex"
 	"ethereum-evm/common"
 	"ethereum-evm/common/math"
 	"fmt"
 	"hash"
 	"math/big"
-	"os"
 
 	"github.com/cloudflare/cfssl/log"
 	"github.com/ethereum/go-ethereum/crypto"
 )
 
 type Config struct {
-	Debug bool // Enables debugging
-	// Tracer                  Tracer // Opcode logger
-	NoRecursion             bool // Disables call, callcode, delegate call and create
-	NoBaseFee               bool // Forces the EIP-1559 baseFee to 0 (needed for 0 price calls)
-	EnablePreimageRecording bool // Enables recording of SHA3/keccak preimages
+	Debug                   bool   // Enables debugging
+	Tracer                  Tracer // Opcode logger
+	NoRecursion             bool   // Disables call, callcode, delegate call and create
+	NoBaseFee               bool   // Forces the EIP-1559 baseFee to 0 (needed for 0 price calls)
+	EnablePreimageRecording bool   // Enables recording of SHA3/keccak preimages
 
 	JumpTable [256]*operation // EVM instruction table, automatically populated if unset
 
 	ExtraEips []int // Additional EIPS that are to be enabled
+
+	StepHook StepHook // Called after every instruction, nil to run headless
 }
 
 // ScopeContext contains the things that are per-call, such as stack and memory,
@@ -58,27 +58,30 @@ func NewEVMInterpreter(evm *EVM, cfg Config) *EVMInterpreter {
 	// we'll set the default jump table.
 	if cfg.JumpTable[STOP] == nil {
 		var jt JumpTable
-		// switch {
-		// case evm.chainRules.IsLondon:
-		// 	jt = londonInstructionSet
-		// case evm.chainRules.IsBerlin:
-		// 	jt = berlinInstructionSet
-		// case evm.chainRules.IsIstanbul:
-		// 	jt = istanbulInstructionSet
-		// case evm.chainRules.IsConstantinople:
-		// 	jt = constantinopleInstructionSet
-		// case evm.chainRules.IsByzantium:
-		// 	jt = byzantiumInstructionSet
-		// case evm.chainRules.IsEIP158:
-		// 	jt = spuriousDragonInstructionSet
-		// case evm.chainRules.IsEIP150:
-		// 	jt = tangerineWhistleInstructionSet
-		// case evm.chainRules.IsHomestead:
-		// 	jt = homesteadInstructionSet
-		// default:
-		// 	jt = frontierInstructionSet
-		// }
-		jt = londonInstructionSet
+		switch {
+		case evm.chainRules.IsShanghai:
+			jt = shanghaiInstructionSet
+		case evm.chainRules.IsMerge:
+			jt = mergeInstructionSet
+		case evm.chainRules.IsLondon:
+			jt = londonInstructionSet
+		case evm.chainRules.IsBerlin:
+			jt = berlinInstructionSet
+		case evm.chainRules.IsIstanbul:
+			jt = istanbulInstructionSet
+		case evm.chainRules.IsConstantinople:
+			jt = constantinopleInstructionSet
+		case evm.chainRules.IsByzantium:
+			jt = byzantiumInstructionSet
+		case evm.chainRules.IsEIP158:
+			jt = spuriousDragonInstructionSet
+		case evm.chainRules.IsEIP150:
+			jt = tangerineWhistleInstructionSet
+		case evm.chainRules.IsHomestead:
+			jt = homesteadInstructionSet
+		default:
+			jt = frontierInstructionSet
+		}
 		for i, eip := range cfg.ExtraEips {
 			if err := EnableEIP(eip, &jt); err != nil {
 				// Disable it, so caller can check if it's activated or not
@@ -96,7 +99,22 @@ func NewEVMInterpreter(evm *EVM, cfg Config) *EVMInterpreter {
 }
 
 func (in *EVMInterpreter) Run(contract *Contract, input []byte, readOnly bool) (ret []byte, err error) {
+	// Increment the call depth which is restricted to 1024
+	in.evm.depth++
+	defer func() { in.evm.depth-- }()
+
+	// Make sure the readOnly is only set if we aren't in readOnly yet.
+	// This also makes sure that the readOnly flag isn't removed for child calls.
+	if readOnly && !in.readOnly {
+		in.readOnly = true
+		defer func() { in.readOnly = false }()
+	}
+
+	// Reset the previous call's return data. It's unimportant to preserve the old buffer
+	// as every returning call will return new data anyway.
+	in.returnData = nil
 
+	// Don't bother with the execution if there's no code.
 	if len(contract.Code) == 0 {
 		return nil, nil
 	}
@@ -112,40 +130,78 @@ func (in *EVMInterpreter) Run(contract *Contract, input []byte, readOnly bool) (
 		// For optimisation reason we're using uint64 as the program counter.
 		// It's theoretically possible to go above 2^64. The YP defines the PC
 		// to be uint256. Practically much less so feasible.
-		pc = uint64(0) // program counter
-		// cost uint64      // gas花费
-		// // copies used by tracer
-		// // debug使用
-		// pcCopy uint64 // needed for the deferred Tracer
-		// // debug使用
-		// gasCopy uint64 // for Tracer to log gas remaining before execution
-		// // debug使用
-		// logged bool // deferred Tracer should ignore already logged steps
-		// // 当前操作码执行函数的返回值
+		pc   = uint64(0) // program counter
+		cost uint64      // gas花费
+		// copies used by tracer
+		// debug使用
+		pcCopy  uint64 // needed for the deferred Tracer
+		gasCopy uint64 // for Tracer to log gas remaining before execution
+		logged  bool   // deferred Tracer should ignore already logged steps
+		// 当前操作码执行函数的返回值
 		res []byte // result of the opcode execution function
 	)
 	contract.Input = input
 	codeLen := uint64(len(contract.Code))
 
-	scanner := bufio.NewScanner(os.Stdin)
-	for {
-		scanner.Scan()
+	if in.cfg.Debug {
+		defer func() {
+			if err != nil {
+				if !logged {
+					in.cfg.Tracer.CaptureState(in.evm, pcCopy, op, gasCopy, cost, callContext, in.returnData, in.evm.depth, err)
+				} else {
+					in.cfg.Tracer.CaptureFault(in.evm, pcCopy, op, gasCopy, cost, callContext, in.evm.depth, err)
+				}
+			}
+		}()
+	}
+	for steps := 0; ; steps++ {
 		if pc >= codeLen {
 			break
 		}
-		fmt.Printf("##pc==>%04x\n", pc)
+		// Stop every thousand steps if the EVM was cancelled, a trace timing out
+		// for example.
+		if steps%1000 == 0 && in.evm.Cancelled() {
+			break
+		}
+		if in.cfg.Debug {
+			// Capture pre-execution values for tracing.
+			logged, pcCopy, gasCopy = false, pc, contract.Gas
+		}
 		op = contract.GetOp(pc)
 		operation := in.cfg.JumpTable[op]
-		fmt.Println(op)
 		if operation == nil {
 			return nil, &ErrInvalidOpCode{opcode: op}
 		}
-
-		// mem.Resize(1024)
+		// Validate stack
+		if sLen := stack.len(); sLen < operation.minStack {
+			return nil, &ErrStackUnderflow{stackLen: sLen, required: operation.minStack}
+		} else if sLen > operation.maxStack {
+			return nil, &ErrStackOverflow{stackLen: sLen, limit: operation.maxStack}
+		}
+		// If the operation is valid, enforce write restrictions
+		if in.readOnly && in.evm.chainRules.IsByzantium {
+			// If the interpreter is operating in readonly mode, make sure no
+			// state-modifying operation is performed. The 3rd stack item
+			// for a call operation is the value. Transferring value from one
+			// account to the others means the state is modified and should also
+			// return with an error.
+			if operation.writes || (op == CALL && stack.Back(2).Sign() != 0) {
+				return nil, ErrWriteProtection
+			}
+		}
+		// Static portion of gas
+		// 指令的固定gas消耗
+		cost = operation.constantGas
+		if !contract.UseGas(operation.constantGas) {
+			return nil, ErrOutOfGas
+		}
 
 		var memorySize uint64
+		// calculate the new memory size and expand the memory to fit
+		// the operation
+		// Memory check needs to be done prior to evaluating the dynamic gas portion,
+		// to detect calculation overflows
 		if operation.memorySize != nil {
-			// stack.Print()
 			memSize, overflow := operation.memorySize(stack)
 			if overflow {
 				return nil, ErrGasUintOverflow
@@ -156,17 +212,31 @@ func (in *EVMInterpreter) Run(contract *Contract, input []byte, readOnly bool) (
 				return nil, ErrGasUintOverflow
 			}
 		}
+		// Dynamic portion of gas
+		// consume the gas and return an error if not enough gas is available.
+		// 指令的动态gas消耗（包括内存扩展的gas）
+		if operation.dynamicGas != nil {
+			var dynamicCost uint64
+			dynamicCost, err = operation.dynamicGas(in.evm, contract, stack, mem, memorySize)
+			cost += dynamicCost
+			if err != nil || !contract.UseGas(dynamicCost) {
+				return nil, ErrOutOfGas
+			}
+		}
 		if memorySize > 0 {
-			fmt.Println("##memorySize: ", memorySize)
 			mem.Resize(memorySize)
 		}
 
+		if in.cfg.Debug {
+			in.cfg.Tracer.CaptureState(in.evm, pc, op, gasCopy, cost, callContext, in.returnData, in.evm.depth, err)
+			logged = true
+		}
+
+		stepPc := pc
 		res, err = operation.execute(&pc, in, callContext)
-		stack.PrintReverse()
-		if mem.Len() > 0 {
-			mem.Print()
+		if in.cfg.StepHook != nil {
+			in.cfg.StepHook(in.evm, stepPc, op, contract.Gas, cost, callContext)
 		}
-		in.evm.StateDB.PrintAccount(contract.Address())
 		if operation.returns {
 			in.returnData = res
 		}
@@ -0,0 +1,50 @@
+package vm
+
+import (
+	"math/big"
+	"testing"
+
+	"ethereum-evm/params"
+
+	"github.com/ethereum/go-ethereum/common"
+)
+
+// TestInstructionSetSelection checks that the interpreter picks its jump
+// table from the fork rules active at the configured block.
+func TestInstructionSetSelection(t *testing.T) {
+	random := common.Hash{}
+	tests := []struct {
+		config  *params.ChainConfig
+		number  int64
+		time    int64
+		random  *common.Hash
+		push0   bool
+		basefee bool
+		chainid bool
+	}{
+		{params.MainnetChainConfig, 0, 0, nil, false, false, false},
+		{params.MainnetChainConfig, 9069000, 0, nil, false, false, true},
+		{params.MainnetChainConfig, 12965000, 0, nil, false, true, true},
+		{params.MainnetChainConfig, 17034870, 1681338455, &random, true, true, true},
+		{params.MainnetChainConfig, 17034870, 1681338455, nil, false, true, true},
+		{params.AllEthashProtocolChanges, 0, 0, nil, false, true, true},
+		{params.AllDevChainProtocolChanges, 0, 0, &random, true, true, true},
+	}
+	for i, tt := range tests {
+		blockCtx := BlockContext{
+			BlockNumber: big.NewInt(tt.number),
+			Time:        big.NewInt(tt.time),
+			Random:      tt.random,
+		}
+		jt := NewEVM(blockCtx, TxContext{}, nil, tt.config, Config{}).interpreter.cfg.JumpTable
+		if have := jt[PUSH0] != nil; have != tt.push0 {
+			t.Errorf("test %d: PUSH0 enabled = %v, want %v", i, have, tt.push0)
+		}
+		if have := jt[BASEFEE] != nil; have != tt.basefee {
+			t.Errorf("test %d: BASEFEE enabled = %v, want %v", i, have, tt.basefee)
+		}
+		if have := jt[CHAINID] != nil; have != tt.chainid {
+			t.Errorf("test %d: CHAINID enabled = %v, want %v", i, have, tt.chainid)
+		}
+	}
+}
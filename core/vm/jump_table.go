@@ -17,7 +17,7 @@
 package vm
 
 import (
-	"github.com/ethereum/go-ethereum/params"
+	"ethereum-evm/params"
 )
 
 type (
@@ -32,7 +32,7 @@ type operation struct {
 	// 指令的解释执行函数
 	execute     executionFunc
 	constantGas uint64
-	// dynamicGas  gasFunc
+	dynamicGas  gasFunc
 	// minStack tells how many stack items are required
 	minStack int
 	// maxStack specifies the max length the stack can have for this operation
@@ -65,11 +65,36 @@ var (
 	istanbulInstructionSet         = newIstanbulInstructionSet()
 	berlinInstructionSet           = newBerlinInstructionSet()
 	londonInstructionSet           = newLondonInstructionSet()
+	mergeInstructionSet            = newMergeInstructionSet()
+	shanghaiInstructionSet         = newShanghaiInstructionSet()
 )
 
 // JumpTable contains the EVM opcodes supported at a given fork.
 type JumpTable [256]*operation
 
+// newShanghaiInstructionSet returns the frontier, homestead, byzantium,
+// contantinople, istanbul, petersburg, berlin, london, merge and shanghai
+// instructions.
+func newShanghaiInstructionSet() JumpTable {
+	instructionSet := newMergeInstructionSet()
+	enable3855(&instructionSet) // PUSH0 instruction https://eips.ethereum.org/EIPS/eip-3855
+	enable3860(&instructionSet) // Limit and meter initcode https://eips.ethereum.org/EIPS/eip-3860
+	return instructionSet
+}
+
+// newMergeInstructionSet returns the london instructions with DIFFICULTY
+// replaced by PREVRANDAO.
+func newMergeInstructionSet() JumpTable {
+	instructionSet := newLondonInstructionSet()
+	instructionSet[PREVRANDAO] = &operation{
+		execute:     opRandom,
+		constantGas: GasQuickStep,
+		minStack:    minStack(0, 1),
+		maxStack:    maxStack(0, 1),
+	}
+	return instructionSet
+}
+
 // newLondonInstructionSet returns the frontier, homestead, byzantium,
 // contantinople, istanbul, petersburg, berlin and london instructions.
 func newLondonInstructionSet() JumpTable {
@@ -130,12 +155,12 @@ func newConstantinopleInstructionSet() JumpTable {
 	instructionSet[CREATE2] = &operation{
 		execute:     opCreate2,
 		constantGas: params.Create2Gas,
-		// dynamicGas:  gasCreate2,
-		minStack:   minStack(4, 1),
-		maxStack:   maxStack(4, 1),
-		memorySize: memoryCreate2,
-		writes:     true,
-		returns:    true,
+		dynamicGas:  gasCreate2,
+		minStack:    minStack(4, 1),
+		maxStack:    maxStack(4, 1),
+		memorySize:  memoryCreate2,
+		writes:      true,
+		returns:     true,
 	}
 	return instructionSet
 }
@@ -147,11 +172,11 @@ func newByzantiumInstructionSet() JumpTable {
 	instructionSet[STATICCALL] = &operation{
 		execute:     opStaticCall,
 		constantGas: params.CallGasEIP150,
-		// dynamicGas:  gasStaticCall,
-		minStack:   minStack(6, 1),
-		maxStack:   maxStack(6, 1),
-		memorySize: memoryStaticCall,
-		returns:    true,
+		dynamicGas:  gasStaticCall,
+		minStack:    minStack(6, 1),
+		maxStack:    maxStack(6, 1),
+		memorySize:  memoryStaticCall,
+		returns:     true,
 	}
 	instructionSet[RETURNDATASIZE] = &operation{
 		execute:     opReturnDataSize,
@@ -162,14 +187,14 @@ func newByzantiumInstructionSet() JumpTable {
 	instructionSet[RETURNDATACOPY] = &operation{
 		execute:     opReturnDataCopy,
 		constantGas: GasFastestStep,
-		// dynamicGas:  gasReturnDataCopy,
-		minStack:   minStack(3, 0),
-		maxStack:   maxStack(3, 0),
-		memorySize: memoryReturnDataCopy,
+		dynamicGas:  gasReturnDataCopy,
+		minStack:    minStack(3, 0),
+		maxStack:    maxStack(3, 0),
+		memorySize:  memoryReturnDataCopy,
 	}
 	instructionSet[REVERT] = &operation{
-		execute: opRevert,
-		// dynamicGas: gasRevert,
+		execute:    opRevert,
+		dynamicGas: gasRevert,
 		minStack:   minStack(2, 0),
 		maxStack:   maxStack(2, 0),
 		memorySize: memoryRevert,
@@ -182,7 +207,7 @@ func newByzantiumInstructionSet() JumpTable {
 // EIP 158 a.k.a Spurious Dragon
 func newSpuriousDragonInstructionSet() JumpTable {
 	instructionSet := newTangerineWhistleInstructionSet()
-	// instructionSet[EXP].dynamicGas = gasExpEIP158
+	instructionSet[EXP].dynamicGas = gasExpEIP158
 	return instructionSet
 
 }
@@ -205,8 +230,8 @@ func newTangerineWhistleInstructionSet() JumpTable {
 func newHomesteadInstructionSet() JumpTable {
 	instructionSet := newFrontierInstructionSet()
 	instructionSet[DELEGATECALL] = &operation{
-		execute: opDelegateCall,
-		// dynamicGas:  gasDelegateCall,
+		execute:     opDelegateCall,
+		dynamicGas:  gasDelegateCall,
 		constantGas: params.CallGasFrontier,
 		minStack:    minStack(6, 1),
 		maxStack:    maxStack(6, 1),
@@ -282,10 +307,10 @@ func newFrontierInstructionSet() JumpTable {
 			maxStack:    maxStack(3, 1),
 		},
 		EXP: {
-			execute: opExp,
-			// // dynamicGas: gasExpFrontier,
-			minStack: minStack(2, 1),
-			maxStack: maxStack(2, 1),
+			execute:    opExp,
+			dynamicGas: gasExpFrontier,
+			minStack:   minStack(2, 1),
+			maxStack:   maxStack(2, 1),
 		},
 		SIGNEXTEND: {
 			execute:     opSignExtend,
@@ -360,12 +385,12 @@ func newFrontierInstructionSet() JumpTable {
 			maxStack:    maxStack(2, 1),
 		},
 		SHA3: {
-			execute: opSha3,
-			// constantGas: params.Sha3Gas,
-			// // dynamicGas:  gasSha3,
-			minStack:   minStack(2, 1),
-			maxStack:   maxStack(2, 1),
-			memorySize: memorySha3,
+			execute:     opSha3,
+			constantGas: params.Sha3Gas,
+			dynamicGas:  gasSha3,
+			minStack:    minStack(2, 1),
+			maxStack:    maxStack(2, 1),
+			memorySize:  memorySha3,
 		},
 		ADDRESS: {
 			execute:     opAddress,
@@ -412,10 +437,10 @@ func newFrontierInstructionSet() JumpTable {
 		CALLDATACOPY: {
 			execute:     opCallDataCopy,
 			constantGas: GasFastestStep,
-			// dynamicGas:  gasCallDataCopy,
-			minStack:   minStack(3, 0),
-			maxStack:   maxStack(3, 0),
-			memorySize: memoryCallDataCopy,
+			dynamicGas:  gasCallDataCopy,
+			minStack:    minStack(3, 0),
+			maxStack:    maxStack(3, 0),
+			memorySize:  memoryCallDataCopy,
 		},
 		CODESIZE: {
 			execute:     opCodeSize,
@@ -426,10 +451,10 @@ func newFrontierInstructionSet() JumpTable {
 		CODECOPY: {
 			execute:     opCodeCopy,
 			constantGas: GasFastestStep,
-			// dynamicGas:  gasCodeCopy,
-			minStack:   minStack(3, 0),
-			maxStack:   maxStack(3, 0),
-			memorySize: memoryCodeCopy,
+			dynamicGas:  gasCodeCopy,
+			minStack:    minStack(3, 0),
+			maxStack:    maxStack(3, 0),
+			memorySize:  memoryCodeCopy,
 		},
 		GASPRICE: {
 			execute:     opGasprice,
@@ -438,18 +463,18 @@ func newFrontierInstructionSet() JumpTable {
 			maxStack:    maxStack(0, 1),
 		},
 		EXTCODESIZE: {
-			execute: opExtCodeSize,
-			// constantGas: params.ExtcodeSizeGasFrontier,
-			minStack: minStack(1, 1),
-			maxStack: maxStack(1, 1),
+			execute:     opExtCodeSize,
+			constantGas: params.ExtcodeSizeGasFrontier,
+			minStack:    minStack(1, 1),
+			maxStack:    maxStack(1, 1),
 		},
 		EXTCODECOPY: {
-			execute: opExtCodeCopy,
-			// constantGas: params.ExtcodeCopyBaseFrontier,
-			// dynamicGas:  gasExtCodeCopy,
-			minStack:   minStack(4, 0),
-			maxStack:   maxStack(4, 0),
-			memorySize: memoryExtCodeCopy,
+			execute:     opExtCodeCopy,
+			constantGas: params.ExtcodeCopyBaseFrontier,
+			dynamicGas:  gasExtCodeCopy,
+			minStack:    minStack(4, 0),
+			maxStack:    maxStack(4, 0),
+			memorySize:  memoryExtCodeCopy,
 		},
 		BLOCKHASH: {
 			execute:     opBlockhash,
@@ -496,39 +521,39 @@ func newFrontierInstructionSet() JumpTable {
 		MLOAD: {
 			execute:     opMload,
 			constantGas: GasFastestStep,
-			// dynamicGas:  gasMLoad,
-			minStack:   minStack(1, 1),
-			maxStack:   maxStack(1, 1),
-			memorySize: memoryMLoad,
+			dynamicGas:  gasMLoad,
+			minStack:    minStack(1, 1),
+			maxStack:    maxStack(1, 1),
+			memorySize:  memoryMLoad,
 		},
 		MSTORE: {
 			execute:     opMstore,
 			constantGas: GasFastestStep,
-			// dynamicGas:  gasMStore,
-			minStack:   minStack(2, 0),
-			maxStack:   maxStack(2, 0),
-			memorySize: memoryMStore,
+			dynamicGas:  gasMStore,
+			minStack:    minStack(2, 0),
+			maxStack:    maxStack(2, 0),
+			memorySize:  memoryMStore,
 		},
 		MSTORE8: {
 			execute:     opMstore8,
 			constantGas: GasFastestStep,
-			// dynamicGas:  gasMStore8,
-			memorySize: memoryMStore8,
-			minStack:   minStack(2, 0),
-			maxStack:   maxStack(2, 0),
+			dynamicGas:  gasMStore8,
+			memorySize:  memoryMStore8,
+			minStack:    minStack(2, 0),
+			maxStack:    maxStack(2, 0),
 		},
 		SLOAD: {
-			execute: opSload,
-			// constantGas: params.SloadGasFrontier,
-			minStack: minStack(1, 1),
-			maxStack: maxStack(1, 1),
+			execute:     opSload,
+			constantGas: params.SloadGasFrontier,
+			minStack:    minStack(1, 1),
+			maxStack:    maxStack(1, 1),
 		},
 		SSTORE: {
-			execute: opSstore,
-			// dynamicGas: gasSStore,
-			minStack: minStack(2, 0),
-			maxStack: maxStack(2, 0),
-			writes:   true,
+			execute:    opSstore,
+			dynamicGas: gasSStore,
+			minStack:   minStack(2, 0),
+			maxStack:   maxStack(2, 0),
+			writes:     true,
 		},
 		JUMP: {
 			execute:     opJump,
@@ -563,10 +588,10 @@ func newFrontierInstructionSet() JumpTable {
 			maxStack:    maxStack(0, 1),
 		},
 		JUMPDEST: {
-			execute: opJumpdest,
-			// constantGas: params.JumpdestGas,
-			minStack: minStack(0, 0),
-			maxStack: maxStack(0, 0),
+			execute:     opJumpdest,
+			constantGas: params.JumpdestGas,
+			minStack:    minStack(0, 0),
+			maxStack:    maxStack(0, 0),
 		},
 		PUSH1: {
 			execute:     opPush1,
@@ -953,40 +978,40 @@ func newFrontierInstructionSet() JumpTable {
 			maxStack:    maxSwapStack(17),
 		},
 		LOG0: {
-			execute: makeLog(0),
-			// dynamicGas: makeGasLog(0),
+			execute:    makeLog(0),
+			dynamicGas: makeGasLog(0),
 			minStack:   minStack(2, 0),
 			maxStack:   maxStack(2, 0),
 			memorySize: memoryLog,
 			writes:     true,
 		},
 		LOG1: {
-			execute: makeLog(1),
-			// dynamicGas: makeGasLog(1),
+			execute:    makeLog(1),
+			dynamicGas: makeGasLog(1),
 			minStack:   minStack(3, 0),
 			maxStack:   maxStack(3, 0),
 			memorySize: memoryLog,
 			writes:     true,
 		},
 		LOG2: {
-			execute: makeLog(2),
-			// dynamicGas: makeGasLog(2),
+			execute:    makeLog(2),
+			dynamicGas: makeGasLog(2),
 			minStack:   minStack(4, 0),
 			maxStack:   maxStack(4, 0),
 			memorySize: memoryLog,
 			writes:     true,
 		},
 		LOG3: {
-			execute: makeLog(3),
-			// dynamicGas: makeGasLog(3),
+			execute:    makeLog(3),
+			dynamicGas: makeGasLog(3),
 			minStack:   minStack(5, 0),
 			maxStack:   maxStack(5, 0),
 			memorySize: memoryLog,
 			writes:     true,
 		},
 		LOG4: {
-			execute: makeLog(4),
-			// dynamicGas: makeGasLog(4),
+			execute:    makeLog(4),
+			dynamicGas: makeGasLog(4),
 			minStack:   minStack(6, 0),
 			maxStack:   maxStack(6, 0),
 			memorySize: memoryLog,
@@ -995,46 +1020,46 @@ func newFrontierInstructionSet() JumpTable {
 		CREATE: {
 			execute:     opCreate,
 			constantGas: params.CreateGas,
-			// dynamicGas:  gasCreate,
-			minStack:   minStack(3, 1),
-			maxStack:   maxStack(3, 1),
-			memorySize: memoryCreate,
-			writes:     true,
-			returns:    true,
+			dynamicGas:  gasCreate,
+			minStack:    minStack(3, 1),
+			maxStack:    maxStack(3, 1),
+			memorySize:  memoryCreate,
+			writes:      true,
+			returns:     true,
 		},
 		CALL: {
 			execute:     opCall,
 			constantGas: params.CallGasFrontier,
-			// dynamicGas:  gasCall,
-			minStack:   minStack(7, 1),
-			maxStack:   maxStack(7, 1),
-			memorySize: memoryCall,
-			returns:    true,
+			dynamicGas:  gasCall,
+			minStack:    minStack(7, 1),
+			maxStack:    maxStack(7, 1),
+			memorySize:  memoryCall,
+			returns:     true,
 		},
 		CALLCODE: {
 			execute:     opCallCode,
 			constantGas: params.CallGasFrontier,
-			// dynamicGas:  gasCallCode,
-			minStack:   minStack(7, 1),
-			maxStack:   maxStack(7, 1),
-			memorySize: memoryCall,
-			returns:    true,
+			dynamicGas:  gasCallCode,
+			minStack:    minStack(7, 1),
+			maxStack:    maxStack(7, 1),
+			memorySize:  memoryCall,
+			returns:     true,
 		},
 		RETURN: {
-			execute: opReturn,
-			// dynamicGas: gasReturn,
+			execute:    opReturn,
+			dynamicGas: gasReturn,
 			minStack:   minStack(2, 0),
 			maxStack:   maxStack(2, 0),
 			memorySize: memoryReturn,
 			halts:      true,
 		},
 		SELFDESTRUCT: {
-			execute: opSuicide,
-			// dynamicGas: gasSelfdestruct,
-			minStack: minStack(1, 0),
-			maxStack: maxStack(1, 0),
-			halts:    true,
-			writes:   true,
+			execute:    opSuicide,
+			dynamicGas: gasSelfdestruct,
+			minStack:   minStack(1, 0),
+			maxStack:   maxStack(1, 0),
+			halts:      true,
+			writes:     true,
 		},
 	}
 }
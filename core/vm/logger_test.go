@@ -0,0 +1,192 @@
+// Copyright 2016 The go-ethereum Authors
+// This file is part of the go-ethereum library.
+//
+// The go-ethereum library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-ethereum library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-ethereum library. If not, see <http://www.gnu.org/licenses/>.
+
+package vm
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"math/big"
+	"testing"
+	"time"
+
+	"ethereum-evm/common/math"
+	"ethereum-evm/params"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/holiman/uint256"
+)
+
+// stepTracer records the opcodes, depths and gas handed to CaptureState.
+type stepTracer struct {
+	ops    []OpCode
+	depths []int
+	gas    []uint64
+	faults int
+}
+
+func (t *stepTracer) CaptureStart(env *EVM, from common.Address, to common.Address, create bool, input []byte, gas uint64, value *big.Int) {
+}
+func (t *stepTracer) CaptureState(env *EVM, pc uint64, op OpCode, gas, cost uint64, scope *ScopeContext, rData []byte, depth int, err error) {
+	t.ops = append(t.ops, op)
+	t.depths = append(t.depths, depth)
+	t.gas = append(t.gas, gas)
+}
+func (t *stepTracer) CaptureEnter(typ OpCode, from common.Address, to common.Address, input []byte, gas uint64, value *big.Int) {
+}
+func (t *stepTracer) CaptureExit(output []byte, gasUsed uint64, err error) {}
+func (t *stepTracer) CaptureFault(env *EVM, pc uint64, op OpCode, gas, cost uint64, scope *ScopeContext, depth int, err error) {
+	t.faults++
+}
+func (t *stepTracer) CaptureEnd(output []byte, gasUsed uint64, t2 time.Duration, err error) {}
+func (t *stepTracer) CaptureTxStart(gasLimit uint64)                                        {}
+func (t *stepTracer) CaptureTxEnd(restGas uint64)                                           {}
+
+func TestTracerCaptureState(t *testing.T) {
+	tracer := new(stepTracer)
+	blockCtx := BlockContext{BlockNumber: new(big.Int), Time: new(big.Int)}
+	env := NewEVM(blockCtx, TxContext{}, nil, params.AllEthashProtocolChanges, Config{Debug: true, Tracer: tracer})
+
+	// PUSH1 0x01 PUSH1 0x02 ADD POP STOP
+	code := []byte{byte(PUSH1), 0x01, byte(PUSH1), 0x02, byte(ADD), byte(POP), byte(STOP)}
+	contract := NewContract(AccountRef(common.Address{}), AccountRef(common.Address{}), new(big.Int), 100)
+	contract.Code = code
+	if _, err := env.interpreter.Run(contract, nil, false); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	want := []OpCode{PUSH1, PUSH1, ADD, POP, STOP}
+	if len(tracer.ops) != len(want) {
+		t.Fatalf("captured %d steps, want %d", len(tracer.ops), len(want))
+	}
+	for i, op := range want {
+		if tracer.ops[i] != op {
+			t.Errorf("step %d: op %v, want %v", i, tracer.ops[i], op)
+		}
+		if tracer.depths[i] != 1 {
+			t.Errorf("step %d: depth %d, want 1", i, tracer.depths[i])
+		}
+	}
+	if tracer.gas[0] != 100 || tracer.gas[1] != 97 {
+		t.Errorf("gas not captured before execution: %v", tracer.gas)
+	}
+	if tracer.faults != 0 {
+		t.Errorf("unexpected faults: %d", tracer.faults)
+	}
+}
+
+func TestStructLogMarshalJSON(t *testing.T) {
+	log := StructLog{
+		Pc:            7,
+		Op:            ADD,
+		Gas:           0x2540be400,
+		GasCost:       3,
+		MemorySize:    0,
+		Stack:         []uint256.Int{*uint256.NewInt(1), *uint256.NewInt(2)},
+		Depth:         1,
+		RefundCounter: 0,
+		Err:           ErrOutOfGas,
+	}
+	enc, err := json.Marshal(log)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := `{"pc":7,"op":1,"gas":"0x2540be400","gasCost":"0x3","memory":"0x","memSize":0,"stack":["0x1","0x2"],"returnData":"0x","depth":1,"refund":0,"opName":"ADD","error":"out of gas"}`
+	if string(enc) != want {
+		t.Errorf("encoding mismatch\nhave %s\nwant %s", enc, want)
+	}
+}
+
+// refundStateDB is a codeStateDB without refunds, which is all the JSON logger
+// needs on top of it.
+type refundStateDB struct {
+	*codeStateDB
+}
+
+func (db *refundStateDB) GetRefund() uint64 { return 0 }
+
+func TestJSONLogger(t *testing.T) {
+	var (
+		contract = common.HexToAddress("0xaa")
+		// MSTORE8(0, 0x2a) RETURN(0, 1)
+		code = []byte{
+			byte(PUSH1), 0x2a, byte(PUSH1), 0x00, byte(MSTORE8),
+			byte(PUSH1), 0x01, byte(PUSH1), 0x00, byte(RETURN),
+		}
+		statedb = &refundStateDB{&codeStateDB{code: map[common.Address][]byte{contract: code}}}
+		out     bytes.Buffer
+	)
+	config := Config{Debug: true, Tracer: NewJSONLogger(nil, &out)}
+	evm := NewEVM(BlockContext{CanTransfer: canTransfer, Transfer: transfer}, TxContext{}, statedb, byzantiumConfig, config)
+	if _, _, err := evm.Call(AccountRef(common.Address{}), contract, nil, 100000, new(big.Int)); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	type step struct {
+		Pc      uint64              `json:"pc"`
+		Op      OpCode              `json:"op"`
+		Gas     math.HexOrDecimal64 `json:"gas"`
+		GasCost math.HexOrDecimal64 `json:"gasCost"`
+		Stack   []string            `json:"stack"`
+		Depth   int                 `json:"depth"`
+	}
+	want := []step{
+		{0, PUSH1, 100000, 3, []string{}, 1},
+		{2, PUSH1, 99997, 3, []string{"0x2a"}, 1},
+		{4, MSTORE8, 99994, 6, []string{"0x2a", "0x0"}, 1},
+		{5, PUSH1, 99988, 3, []string{}, 1},
+		{7, PUSH1, 99985, 3, []string{"0x1"}, 1},
+		{9, RETURN, 99982, 0, []string{"0x1", "0x0"}, 1},
+	}
+	scanner := bufio.NewScanner(&out)
+	for i, w := range want {
+		if !scanner.Scan() {
+			t.Fatalf("step %d: missing line", i)
+		}
+		var have step
+		if err := json.Unmarshal(scanner.Bytes(), &have); err != nil {
+			t.Fatalf("step %d: invalid line %s: %v", i, scanner.Bytes(), err)
+		}
+		if have.Pc != w.Pc || have.Op != w.Op || have.Gas != w.Gas || have.GasCost != w.GasCost || have.Depth != w.Depth {
+			t.Errorf("step %d mismatch: have %+v, want %+v", i, have, w)
+		}
+		if len(have.Stack) != len(w.Stack) {
+			t.Errorf("step %d: stack mismatch: have %v, want %v", i, have.Stack, w.Stack)
+			continue
+		}
+		for j := range w.Stack {
+			if have.Stack[j] != w.Stack[j] {
+				t.Errorf("step %d: stack mismatch: have %v, want %v", i, have.Stack, w.Stack)
+				break
+			}
+		}
+	}
+	if !scanner.Scan() {
+		t.Fatal("missing summary line")
+	}
+	var summary struct {
+		Output  string              `json:"output"`
+		GasUsed math.HexOrDecimal64 `json:"gasUsed"`
+	}
+	if err := json.Unmarshal(scanner.Bytes(), &summary); err != nil {
+		t.Fatalf("invalid summary line %s: %v", scanner.Bytes(), err)
+	}
+	if summary.Output != "2a" || summary.GasUsed != 18 {
+		t.Errorf("summary mismatch: have %+v, want output 2a and 18 gas used", summary)
+	}
+	if scanner.Scan() {
+		t.Errorf("unexpected line: %s", scanner.Bytes())
+	}
+}
@@ -104,6 +104,9 @@ const (
 	CHAINID     OpCode = 0x46
 	SELFBALANCE OpCode = 0x47
 	BASEFEE     OpCode = 0x48
+
+	// PREVRANDAO replaces DIFFICULTY after the merge (EIP-4399).
+	PREVRANDAO OpCode = DIFFICULTY
 )
 
 // 0x50 range - 'storage' and execution.
@@ -120,6 +123,7 @@ const (
 	MSIZE    OpCode = 0x59
 	GAS      OpCode = 0x5a
 	JUMPDEST OpCode = 0x5b
+	PUSH0    OpCode = 0x5f
 )
 
 // 0x60 range.
@@ -298,6 +302,7 @@ var opCodeToString = map[OpCode]string{
 	MSIZE:    "MSIZE",
 	GAS:      "GAS",
 	JUMPDEST: "JUMPDEST",
+	PUSH0:    "PUSH0",
 
 	// 0x60 range - push.
 	PUSH1:  "PUSH1",
@@ -464,6 +469,7 @@ var stringToOp = map[string]OpCode{
 	"MSIZE":          MSIZE,
 	"GAS":            GAS,
 	"JUMPDEST":       JUMPDEST,
+	"PUSH0":          PUSH0,
 	"PUSH1":          PUSH1,
 	"PUSH2":          PUSH2,
 	"PUSH3":          PUSH3,
@@ -621,6 +627,7 @@ var opCodeInfoList = map[string]OpCodeInfo{
 	"MSIZE":          OpCodeInfo{0, 0, 0, 0},
 	"GAS":            OpCodeInfo{0, 0, 0, 0},
 	"JUMPDEST":       OpCodeInfo{0, 0, 0, 0},
+	"PUSH0":          OpCodeInfo{0, 0, 0, 0},
 	"PUSH1":          OpCodeInfo{1, 0, 0, 0},
 	"PUSH2":          OpCodeInfo{2, 0, 0, 0},
 	"PUSH3":          OpCodeInfo{3, 0, 0, 0},
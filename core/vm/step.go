@@ -0,0 +1,36 @@
+package vm
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+)
+
+// StepHook is called by the interpreter after every executed instruction.
+// pc and op describe the instruction, gas is the gas left after it and cost
+// the gas it consumed. Stepping is opt-in: without a hook the interpreter
+// runs headless.
+type StepHook func(evm *EVM, pc uint64, op OpCode, gas, cost uint64, scope *ScopeContext)
+
+// PrintStep is a StepHook that dumps the executed instruction, the gas, the
+// stack, the memory and the executing account to stdout.
+func PrintStep(evm *EVM, pc uint64, op OpCode, gas, cost uint64, scope *ScopeContext) {
+	fmt.Printf("##pc==>%04x %v\n", pc, op)
+	fmt.Printf("##gas==>%d cost==>%d\n", gas, cost)
+	scope.Stack.PrintReverse()
+	if scope.Memory.Len() > 0 {
+		scope.Memory.Print()
+	}
+	evm.StateDB.PrintAccount(scope.Contract.Address())
+}
+
+// NewInteractiveStepHook returns a StepHook that prints every step like
+// PrintStep and then blocks until a line has been read from r, so that the
+// execution can be followed instruction by instruction.
+func NewInteractiveStepHook(r io.Reader) StepHook {
+	scanner := bufio.NewScanner(r)
+	return func(evm *EVM, pc uint64, op OpCode, gas, cost uint64, scope *ScopeContext) {
+		PrintStep(evm, pc, op, gas, cost, scope)
+		scanner.Scan()
+	}
+}
@@ -0,0 +1,224 @@
+// Copyright 2023 The go-ethereum Authors
+// This file is part of the go-ethereum library.
+//
+// The go-ethereum library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-ethereum library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-ethereum library. If not, see <http://www.gnu.org/licenses/>.
+
+// Package gasestimator searches for the lowest gas limit a message executes
+// successfully with.
+package gasestimator
+
+import (
+	"context"
+	"errors"
+	"ethereum-evm/core"
+	"ethereum-evm/core/state"
+	"ethereum-evm/core/vm"
+	"ethereum-evm/params"
+	"fmt"
+	"math"
+	"math/big"
+
+	"github.com/ethereum/go-ethereum/accounts/abi"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/log"
+)
+
+// Options are the contextual parameters to execute the requested call.
+type Options struct {
+	Config *params.ChainConfig // Chain configuration for hard fork selection
+	Chain  core.ChainContext   // Chain context to access past block hashes
+	Header *types.Header       // Header defining the block context to execute in
+}
+
+// EstimateGas returns the lowest possible gas limit that allows the message to
+// run successfully on top of the given state, searching between the intrinsic
+// gas of the message and the gas limit of the block. Every execution happens
+// on a copy of the state, which is left untouched.
+//
+// The gas limit of the message, if at least params.TxGas, replaces the block
+// gas limit as the upper bound. A non-zero gasCap lowers the upper bound too.
+//
+// If the message reverts, the raw revert data is returned alongside an error
+// carrying the decoded revert reason. If it runs out of gas even with the upper
+// bound, the error reports the allowance it was given.
+func EstimateGas(ctx context.Context, msg *core.Message, state *state.StateDB, opts *Options, gasCap uint64) (uint64, []byte, error) {
+	// Binary search the gas limit, as it may need to be higher than the amount used
+	var (
+		lo uint64 // lowest-known gas limit where tx execution fails
+		hi uint64 // lowest-known gas limit where tx execution succeeds
+	)
+	// Nothing below the intrinsic gas can ever succeed.
+	rules := opts.Config.Rules(opts.Header.Number, opts.Header.Difficulty.Sign() == 0, opts.Header.Time)
+	intrinsic, err := core.IntrinsicGas(msg.Data, msg.AccessList, msg.To == nil, rules.IsHomestead, rules.IsIstanbul, rules.IsShanghai)
+	if err != nil {
+		return 0, nil, err
+	}
+	lo = intrinsic - 1
+
+	// Determine the highest gas limit can be used during the estimation.
+	hi = opts.Header.GasLimit
+	if msg.GasLimit >= params.TxGas {
+		hi = msg.GasLimit
+	}
+	// Normalize the max fee per gas the call is willing to spend.
+	var feeCap *big.Int
+	if msg.GasFeeCap != nil {
+		feeCap = msg.GasFeeCap
+	} else if msg.GasPrice != nil {
+		feeCap = msg.GasPrice
+	} else {
+		feeCap = common.Big0
+	}
+	// Recap the highest gas limit with account's available balance.
+	if feeCap.BitLen() != 0 {
+		balance := state.GetBalance(msg.From)
+		available := new(big.Int).Set(balance)
+		if msg.Value != nil {
+			if msg.Value.Cmp(available) >= 0 {
+				return 0, nil, core.ErrInsufficientFundsForTransfer
+			}
+			available.Sub(available, msg.Value)
+		}
+		allowance := new(big.Int).Div(available, feeCap)
+
+		// If the allowance is larger than maximum uint64, skip checking
+		if allowance.IsUint64() && hi > allowance.Uint64() {
+			transfer := msg.Value
+			if transfer == nil {
+				transfer = new(big.Int)
+			}
+			log.Warn("Gas estimation capped by limited funds", "original", hi, "balance", balance,
+				"sent", transfer, "maxFeePerGas", feeCap, "fundable", allowance)
+			hi = allowance.Uint64()
+		}
+	}
+	// Recap the highest gas allowance with specified gascap.
+	if gasCap != 0 && hi > gasCap {
+		log.Warn("Caller gas above allowance, capping", "requested", hi, "cap", gasCap)
+		hi = gasCap
+	}
+	// We first execute the transaction at the highest allowable gas limit, since
+	// if this fails we can return the error immediately.
+	failed, result, err := execute(ctx, msg, state, opts, hi)
+	if err != nil {
+		return 0, nil, err
+	}
+	if failed {
+		if result != nil && !errors.Is(result.Err, vm.ErrOutOfGas) {
+			if revert := result.Revert(); len(revert) > 0 {
+				return 0, revert, revertReason(revert)
+			}
+			return 0, nil, result.Err
+		}
+		// Otherwise, the specified gas cap is too low
+		return 0, nil, fmt.Errorf("gas required exceeds allowance (%d)", hi)
+	}
+	// The gas consumed by the unconstrained execution lower-bounds the gas limit
+	// required for it to succeed, unless the message inspects the gas left.
+	if result.UsedGas-1 > lo {
+		lo = result.UsedGas - 1
+	}
+	// Refunds and the 63/64 rule for calls often make the message need a bit
+	// more than it consumed. Try that directly to narrow the search quickly.
+	optimistic := (result.UsedGas + params.CallStipend) * 64 / 63
+	if optimistic < hi {
+		failed, _, err = execute(ctx, msg, state, opts, optimistic)
+		if err != nil {
+			return 0, nil, err
+		}
+		if failed {
+			lo = optimistic
+		} else {
+			hi = optimistic
+		}
+	}
+	// Binary search for the smallest gas limit that allows the tx to execute successfully.
+	for lo+1 < hi {
+		mid := (hi + lo) / 2
+		failed, _, err = execute(ctx, msg, state, opts, mid)
+		if err != nil {
+			return 0, nil, err
+		}
+		if failed {
+			lo = mid
+		} else {
+			hi = mid
+		}
+	}
+	return hi, nil, nil
+}
+
+// execute is a helper that executes the message under a given gas limit and
+// returns true if the transaction fails for a reason that might be related to
+// not enough gas. A non-nil error means execution failed due to reasons
+// unrelated to the gas limit.
+func execute(ctx context.Context, msg *core.Message, state *state.StateDB, opts *Options, gasLimit uint64) (bool, *core.ExecutionResult, error) {
+	// Configure the message for this specific execution (and revert the change after)
+	defer func(gas uint64) { msg.GasLimit = gas }(msg.GasLimit)
+	msg.GasLimit = gasLimit
+
+	// Execute the message and separate execution faults caused by a lack of
+	// gas or other non-fixable conditions
+	result, err := run(ctx, msg, state, opts)
+	if err != nil {
+		if errors.Is(err, core.ErrIntrinsicGas) {
+			return true, nil, nil // Special case, raise gas limit
+		}
+		return true, nil, err // Bail out
+	}
+	return result.Failed(), result, nil
+}
+
+// run assembles the EVM as defined by the options and executes the message on
+// a copy of the state.
+func run(ctx context.Context, msg *core.Message, state *state.StateDB, opts *Options) (*core.ExecutionResult, error) {
+	var (
+		dirtyState = state.Copy()
+		evm        = vm.NewEVM(core.NewEVMBlockContext(opts.Header, opts.Chain), core.NewEVMTxContext(msg), dirtyState, opts.Config, vm.Config{NoBaseFee: true})
+	)
+	// Monitor the outer context and interrupt the EVM upon cancellation.
+	done := make(chan struct{})
+	defer close(done)
+	go func() {
+		select {
+		case <-ctx.Done():
+			evm.Cancel()
+		case <-done:
+		}
+	}()
+	// Execute the message, returning a wrapped error or the result
+	result, err := core.ApplyMessage(evm, msg, new(core.GasPool).AddGas(math.MaxUint64))
+	if err := dirtyState.Error(); err != nil {
+		return nil, err
+	}
+	// A cancelled execution stops early and looks successful, never trust it.
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	if err != nil {
+		return result, fmt.Errorf("failed with %d gas: %w", msg.GasLimit, err)
+	}
+	return result, nil
+}
+
+// revertReason returns an execution reverted error holding the reason decoded
+// from the revert data, if it is an Error(string).
+func revertReason(revert []byte) error {
+	reason, err := abi.UnpackRevert(revert)
+	if err != nil {
+		return vm.ErrExecutionReverted
+	}
+	return fmt.Errorf("%w: %v", vm.ErrExecutionReverted, reason)
+}
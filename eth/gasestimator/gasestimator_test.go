@@ -0,0 +1,129 @@
+package gasestimator
+
+import (
+	"context"
+	"errors"
+	"ethereum-evm/core"
+	"ethereum-evm/core/state"
+	"ethereum-evm/core/vm"
+	"ethereum-evm/ethdb/memorydb"
+	"ethereum-evm/params"
+	"math/big"
+	"testing"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core/types"
+)
+
+const ether = 1e18
+
+var (
+	testSender = common.HexToAddress("0x1000")
+	// Reverts unless at least 100000 gas is left after GAS:
+	// PUSH3 100000 GAS LT PUSH1 10 JUMPI STOP JUMPDEST PUSH1 0 DUP1 REVERT
+	testGasChecker = common.HexToAddress("0x2000")
+	// Reverts with the ABI encoding of Error("boom").
+	testReverter = common.HexToAddress("0x3000")
+	// Loops forever: JUMPDEST PUSH1 0 JUMP
+	testLooper = common.HexToAddress("0x4000")
+)
+
+func newTestState(t *testing.T) *state.StateDB {
+	statedb, err := state.New(types.EmptyRootHash, state.NewDatabase(memorydb.New()))
+	if err != nil {
+		t.Fatalf("failed to create state: %v", err)
+	}
+	statedb.SetBalance(testSender, big.NewInt(ether))
+	statedb.SetCode(testGasChecker, common.FromHex("620186a05a10600a57005b600080fd"))
+	statedb.SetCode(testReverter, common.FromHex(
+		"7f08c379a000000000000000000000000000000000000000000000000000000000600052"+
+			"7f0000000000000000000000000000000000000000000000000000000000000020600452"+
+			"7f0000000000000000000000000000000000000000000000000000000000000004602452"+
+			"7f626f6f6d00000000000000000000000000000000000000000000000000000000604452"+
+			"60646000fd"))
+	statedb.SetCode(testLooper, common.FromHex("5b600056"))
+	return statedb
+}
+
+func newTestOptions() *Options {
+	return &Options{
+		Config: params.TestChainConfig,
+		Header: &types.Header{
+			Number:     big.NewInt(1),
+			GasLimit:   30000000,
+			Difficulty: new(big.Int),
+			BaseFee:    big.NewInt(params.InitialBaseFee),
+		},
+	}
+}
+
+func newTestMessage(to common.Address, value int64) *core.Message {
+	return &core.Message{
+		From:              testSender,
+		To:                &to,
+		Value:             big.NewInt(value),
+		GasPrice:          new(big.Int),
+		GasFeeCap:         new(big.Int),
+		GasTipCap:         new(big.Int),
+		SkipAccountChecks: true,
+	}
+}
+
+func TestEstimateGas(t *testing.T) {
+	statedb := newTestState(t)
+
+	// Plain transfers need exactly the intrinsic gas.
+	gas, _, err := EstimateGas(context.Background(), newTestMessage(common.HexToAddress("0x5000"), 1), statedb, newTestOptions(), 0)
+	if err != nil || gas != params.TxGas {
+		t.Errorf("transfer: have %d (%v), want %d", gas, err, params.TxGas)
+	}
+	// The gas checker consumes far less than it needs to succeed, the search
+	// must find the exact limit: intrinsic gas, PUSH3 and GAS, and what has to
+	// be left after them.
+	gas, _, err = EstimateGas(context.Background(), newTestMessage(testGasChecker, 0), statedb, newTestOptions(), 0)
+	if want := params.TxGas + 3 + 2 + 100000; err != nil || gas != want {
+		t.Errorf("gas checker: have %d (%v), want %d", gas, err, want)
+	}
+	// Estimations never modify the state.
+	if balance := statedb.GetBalance(common.HexToAddress("0x5000")); balance.Sign() != 0 {
+		t.Errorf("estimation modified the state: balance %v", balance)
+	}
+}
+
+func TestEstimateGasFailures(t *testing.T) {
+	statedb := newTestState(t)
+
+	// Reverts surface the reason and the raw data.
+	_, revert, err := EstimateGas(context.Background(), newTestMessage(testReverter, 0), statedb, newTestOptions(), 0)
+	if !errors.Is(err, vm.ErrExecutionReverted) || err.Error() != "execution reverted: boom" {
+		t.Errorf("revert error mismatch: have %v, want execution reverted: boom", err)
+	}
+	if len(revert) != 100 {
+		t.Errorf("revert data length mismatch: have %d, want 100", len(revert))
+	}
+	// Running out of gas reports the allowance.
+	_, _, err = EstimateGas(context.Background(), newTestMessage(testLooper, 0), statedb, newTestOptions(), 50000)
+	if err == nil || err.Error() != "gas required exceeds allowance (50000)" {
+		t.Errorf("out of gas error mismatch: have %v", err)
+	}
+	// The allowance is further limited by the funds of the sender.
+	msg := newTestMessage(testLooper, 0)
+	msg.GasFeeCap = big.NewInt(ether / 40000)
+	_, _, err = EstimateGas(context.Background(), msg, statedb, newTestOptions(), 0)
+	if err == nil || err.Error() != "gas required exceeds allowance (40000)" {
+		t.Errorf("funded allowance error mismatch: have %v", err)
+	}
+	// Paying for gas, the value must leave funds for it.
+	msg = newTestMessage(testLooper, ether)
+	msg.GasFeeCap = big.NewInt(1)
+	_, _, err = EstimateGas(context.Background(), msg, statedb, newTestOptions(), 0)
+	if !errors.Is(err, core.ErrInsufficientFundsForTransfer) {
+		t.Errorf("transfer error mismatch: have %v, want %v", err, core.ErrInsufficientFundsForTransfer)
+	}
+	// Cancelled estimations fail instead of returning a bogus estimate.
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if _, _, err = EstimateGas(ctx, newTestMessage(testGasChecker, 0), statedb, newTestOptions(), 0); !errors.Is(err, context.Canceled) {
+		t.Errorf("cancelled estimation error mismatch: have %v, want %v", err, context.Canceled)
+	}
+}
@@ -0,0 +1,78 @@
+// Copyright 2021 The go-ethereum Authors
+// This file is part of the go-ethereum library.
+//
+// The go-ethereum library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-ethereum library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-ethereum library. If not, see <http://www.gnu.org/licenses/>.
+
+package eth
+
+import (
+	"context"
+	"errors"
+	"ethereum-evm/core"
+	"ethereum-evm/core/state"
+	"ethereum-evm/core/vm"
+	"fmt"
+
+	"github.com/ethereum/go-ethereum/core/types"
+)
+
+// StateAtBlock retrieves the state database associated with a certain block.
+// The state of every block is committed when it is sealed, so there is never
+// any need to regenerate it.
+func (b *EthAPIBackend) StateAtBlock(ctx context.Context, block *types.Block) (*state.StateDB, error) {
+	return b.chain.StateAt(block.Root())
+}
+
+// StateAtTransaction returns the execution environment of a certain transaction.
+func (b *EthAPIBackend) StateAtTransaction(ctx context.Context, block *types.Block, txIndex int) (*core.Message, vm.BlockContext, *state.StateDB, error) {
+	// Short circuit if it's genesis block.
+	if block.NumberU64() == 0 {
+		return nil, vm.BlockContext{}, nil, errors.New("no transaction in genesis")
+	}
+	// Create the parent state database
+	parent := b.chain.GetBlockByHash(block.ParentHash())
+	if parent == nil {
+		return nil, vm.BlockContext{}, nil, fmt.Errorf("parent %#x not found", block.ParentHash())
+	}
+	statedb, err := b.StateAtBlock(ctx, parent)
+	if err != nil {
+		return nil, vm.BlockContext{}, nil, err
+	}
+	// Recompute transactions up to the target index.
+	var (
+		config  = b.chain.Config()
+		signer  = core.MakeSigner(config, block.Number())
+		context = core.NewEVMBlockContext(block.Header(), b.chain)
+	)
+	for idx, tx := range block.Transactions() {
+		// Assemble the transaction call message and return if the requested offset
+		msg, err := core.TransactionToMessage(tx, signer, block.BaseFee())
+		if err != nil {
+			return nil, vm.BlockContext{}, nil, err
+		}
+		if idx == txIndex {
+			return msg, context, statedb, nil
+		}
+		// Not yet the searched for transaction, execute on top of the current state
+		vmenv := vm.NewEVM(context, core.NewEVMTxContext(msg), statedb, config, vm.Config{})
+		statedb.Prepare(tx.Hash(), idx)
+		if _, err := core.ApplyMessage(vmenv, msg, new(core.GasPool).AddGas(tx.Gas())); err != nil {
+			return nil, vm.BlockContext{}, nil, fmt.Errorf("transaction %#x failed: %v", tx.Hash(), err)
+		}
+		// Ensure any modifications are committed to the state
+		// Only delete empty objects if EIP158/161 (a.k.a Spurious Dragon) is in effect
+		statedb.Finalise(vmenv.ChainConfig().IsEIP158(block.Number()))
+	}
+	return nil, vm.BlockContext{}, nil, fmt.Errorf("transaction index %d out of range for block %#x", txIndex, block.Hash())
+}
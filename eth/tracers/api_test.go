@@ -0,0 +1,263 @@
+package tracers_test
+
+import (
+	"context"
+	"encoding/json"
+	"ethereum-evm/common/hexutil"
+	"ethereum-evm/core"
+	"ethereum-evm/core/rawdb"
+	"ethereum-evm/core/vm"
+	"ethereum-evm/eth"
+	"ethereum-evm/eth/tracers"
+	_ "ethereum-evm/eth/tracers/native"
+	"ethereum-evm/internal/ethapi"
+	"ethereum-evm/miner"
+	"ethereum-evm/params"
+	"math/big"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/crypto"
+	"github.com/ethereum/go-ethereum/rpc"
+)
+
+var (
+	testKey, _ = crypto.HexToECDSA("b71c71a67e1177ad4e901695e1b4b9ee17ae16c6668d313eac2f96dbcda3f291")
+	testFunded = crypto.PubkeyToAddress(testKey.PublicKey)
+	testCaller = common.HexToAddress("0x2000")
+	testCallee = common.HexToAddress("0x3000")
+	testFunds  = new(big.Int).Exp(big.NewInt(10), big.NewInt(18), nil)
+)
+
+// newTestClient starts a development chain with one transaction sealed and
+// serves the debug APIs over HTTP. It returns the client with the hash of the
+// sealed transaction.
+func newTestClient(t *testing.T) (*rpc.Client, common.Hash) {
+	genesis := &core.Genesis{
+		Config:   params.TestChainConfig,
+		GasLimit: 30000000,
+		BaseFee:  big.NewInt(params.InitialBaseFee),
+		Alloc: core.GenesisAlloc{
+			testFunded: {Balance: testFunds},
+			// Forward the first calldata word to the callee, then SLOAD slot 1:
+			// MSTORE(0, CALLDATALOAD(0)) CALL(GAS, 0x3000, 0, 0, 32, 0, 0) POP SLOAD(1) POP STOP
+			testCaller: {
+				Code:    common.FromHex("60003560005260006000602060006000613000" + "5af150600154500000"),
+				Storage: map[common.Hash]common.Hash{common.HexToHash("0x01"): common.HexToHash("0x01")},
+			},
+			// SSTORE(0, CALLDATALOAD(0)) STOP
+			testCallee: {Code: common.FromHex("60003560005500")},
+		},
+	}
+	chain, err := core.NewBlockChain(rawdb.NewMemoryDatabase(), genesis, vm.Config{})
+	if err != nil {
+		t.Fatalf("failed to create chain: %v", err)
+	}
+	backend := eth.NewEthAPIBackend(chain, miner.New(chain, common.HexToAddress("0xc0ffee")), 25000000)
+
+	tx := types.MustSignNewTx(testKey, types.LatestSignerForChainID(params.TestChainConfig.ChainID), &types.DynamicFeeTx{
+		ChainID:   params.TestChainConfig.ChainID,
+		GasTipCap: big.NewInt(1),
+		GasFeeCap: big.NewInt(2 * params.InitialBaseFee),
+		Gas:       100000,
+		To:        &testCaller,
+		Data:      common.HexToHash("0x2a").Bytes(),
+	})
+	if err := backend.SendTx(context.Background(), tx); err != nil {
+		t.Fatalf("failed to seal transaction: %v", err)
+	}
+	server, err := ethapi.NewServer(append(ethapi.GetAPIs(backend), tracers.APIs(backend)...))
+	if err != nil {
+		t.Fatalf("failed to create server: %v", err)
+	}
+	httpsrv := httptest.NewServer(server)
+	client, err := rpc.DialHTTP(httpsrv.URL)
+	if err != nil {
+		t.Fatalf("failed to dial server: %v", err)
+	}
+	t.Cleanup(func() {
+		client.Close()
+		httpsrv.Close()
+		server.Stop()
+	})
+	return client, tx.Hash()
+}
+
+// receiptGasUsed returns the gas used by the transaction hash.
+func receiptGasUsed(t *testing.T, client *rpc.Client, hash common.Hash) uint64 {
+	var receipt struct {
+		GasUsed hexutil.Uint64 `json:"gasUsed"`
+	}
+	if err := client.Call(&receipt, "eth_getTransactionReceipt", hash); err != nil {
+		t.Fatalf("eth_getTransactionReceipt failed: %v", err)
+	}
+	return uint64(receipt.GasUsed)
+}
+
+func TestTraceTransactionStructLogger(t *testing.T) {
+	client, hash := newTestClient(t)
+
+	var res vm.ExecutionResult
+	if err := client.Call(&res, "debug_traceTransaction", hash); err != nil {
+		t.Fatalf("debug_traceTransaction failed: %v", err)
+	}
+	if res.Failed || res.ReturnValue != "" {
+		t.Errorf("execution result mismatch: failed %v, return value %q", res.Failed, res.ReturnValue)
+	}
+	if gasUsed := receiptGasUsed(t, client, hash); res.Gas != gasUsed {
+		t.Errorf("gas mismatch: have %d, want %d", res.Gas, gasUsed)
+	}
+	var sstore *vm.StructLogRes
+	for i, log := range res.StructLogs {
+		if log.Op == "SSTORE" {
+			sstore = &res.StructLogs[i]
+		}
+	}
+	if len(res.StructLogs) == 0 || res.StructLogs[0].Op != "PUSH1" || sstore == nil {
+		t.Fatalf("struct logs mismatch: %+v", res.StructLogs)
+	}
+	// The callee writes the forwarded word into slot 0 one call deep.
+	if sstore.Depth != 2 || sstore.Stack == nil || sstore.Storage == nil {
+		t.Fatalf("sstore log mismatch: %+v", sstore)
+	}
+	if value := (*sstore.Storage)[common.Hash{}.Hex()[2:]]; value != common.HexToHash("0x2a").Hex()[2:] {
+		t.Errorf("sstore storage mismatch: have %q", value)
+	}
+	// Logger options follow geth's trace config.
+	var limited vm.ExecutionResult
+	if err := client.Call(&limited, "debug_traceTransaction", hash, map[string]interface{}{"disableStack": true, "limit": 3}); err != nil {
+		t.Fatalf("debug_traceTransaction failed: %v", err)
+	}
+	if len(limited.StructLogs) != 3 || limited.StructLogs[0].Stack != nil {
+		t.Errorf("logger options ignored: %+v", limited.StructLogs)
+	}
+}
+
+func TestTraceTransactionCallTracer(t *testing.T) {
+	client, hash := newTestClient(t)
+
+	var frame struct {
+		Type    string         `json:"type"`
+		From    common.Address `json:"from"`
+		To      common.Address `json:"to"`
+		Gas     hexutil.Uint64 `json:"gas"`
+		GasUsed hexutil.Uint64 `json:"gasUsed"`
+		Calls   []struct {
+			Type  string         `json:"type"`
+			To    common.Address `json:"to"`
+			Input hexutil.Bytes  `json:"input"`
+		} `json:"calls"`
+	}
+	if err := client.Call(&frame, "debug_traceTransaction", hash, map[string]interface{}{"tracer": "callTracer"}); err != nil {
+		t.Fatalf("debug_traceTransaction failed: %v", err)
+	}
+	if frame.Type != "CALL" || frame.From != testFunded || frame.To != testCaller {
+		t.Errorf("top frame mismatch: %+v", frame)
+	}
+	// The top frame covers the whole transaction, intrinsic gas included.
+	if gasUsed := receiptGasUsed(t, client, hash); frame.Gas != 100000 || uint64(frame.GasUsed) != gasUsed {
+		t.Errorf("top frame gas mismatch: have %d/%d, want 100000/%d", frame.GasUsed, frame.Gas, gasUsed)
+	}
+	if len(frame.Calls) != 1 || frame.Calls[0].Type != "CALL" || frame.Calls[0].To != testCallee {
+		t.Fatalf("child frames mismatch: %+v", frame.Calls)
+	}
+	if common.BytesToHash(frame.Calls[0].Input) != common.HexToHash("0x2a") {
+		t.Errorf("child input mismatch: %x", frame.Calls[0].Input)
+	}
+	var top json.RawMessage
+	config := map[string]interface{}{"tracer": "callTracer", "tracerConfig": map[string]interface{}{"onlyTopCall": true}}
+	if err := client.Call(&top, "debug_traceTransaction", hash, config); err != nil {
+		t.Fatalf("debug_traceTransaction failed: %v", err)
+	}
+	var topFrame map[string]interface{}
+	if err := json.Unmarshal(top, &topFrame); err != nil || topFrame["calls"] != nil {
+		t.Errorf("onlyTopCall ignored: %s", top)
+	}
+	if err := client.Call(&top, "debug_traceTransaction", hash, map[string]interface{}{"tracer": "noSuchTracer"}); err == nil {
+		t.Errorf("unknown tracer accepted")
+	}
+	if err := client.Call(&top, "debug_traceTransaction", common.Hash{1}); err == nil {
+		t.Errorf("unknown transaction traced")
+	}
+}
+
+type prestateAccount struct {
+	Balance *hexutil.Big                `json:"balance"`
+	Nonce   uint64                      `json:"nonce"`
+	Code    hexutil.Bytes               `json:"code"`
+	Storage map[common.Hash]common.Hash `json:"storage"`
+}
+
+func TestTraceTransactionPrestateTracer(t *testing.T) {
+	client, hash := newTestClient(t)
+
+	var pre map[common.Address]prestateAccount
+	if err := client.Call(&pre, "debug_traceTransaction", hash, map[string]interface{}{"tracer": "prestateTracer"}); err != nil {
+		t.Fatalf("debug_traceTransaction failed: %v", err)
+	}
+	// The sender is reported as it was before paying for the transaction.
+	if sender, ok := pre[testFunded]; !ok || sender.Balance.ToInt().Cmp(testFunds) != 0 || sender.Nonce != 0 {
+		t.Errorf("sender prestate mismatch: %+v", sender)
+	}
+	if caller := pre[testCaller]; len(caller.Code) == 0 || caller.Storage[common.HexToHash("0x01")] != common.HexToHash("0x01") {
+		t.Errorf("caller prestate mismatch: %+v", caller)
+	}
+	if callee, ok := pre[testCallee].Storage[common.Hash{}]; !ok || callee != (common.Hash{}) {
+		t.Errorf("callee prestate mismatch: %+v", pre[testCallee])
+	}
+	var diff struct {
+		Pre  map[common.Address]prestateAccount `json:"pre"`
+		Post map[common.Address]prestateAccount `json:"post"`
+	}
+	config := map[string]interface{}{"tracer": "prestateTracer", "tracerConfig": map[string]interface{}{"diffMode": true}}
+	if err := client.Call(&diff, "debug_traceTransaction", hash, config); err != nil {
+		t.Fatalf("debug_traceTransaction failed: %v", err)
+	}
+	if value := diff.Post[testCallee].Storage[common.Hash{}]; value != common.HexToHash("0x2a") {
+		t.Errorf("callee poststate mismatch: %+v", diff.Post[testCallee])
+	}
+	// Untouched slots and accounts are left out of the diff.
+	if _, ok := diff.Pre[testCaller]; ok {
+		t.Errorf("unmodified caller in diff: %+v", diff.Pre[testCaller])
+	}
+	if diff.Post[testFunded].Nonce != 1 {
+		t.Errorf("sender poststate mismatch: %+v", diff.Post[testFunded])
+	}
+}
+
+func TestTraceCall(t *testing.T) {
+	client, _ := newTestClient(t)
+	input := hexutil.Bytes(common.HexToHash("0x2b").Bytes())
+	args := ethapi.TransactionArgs{From: &testFunded, To: &testCaller, Input: &input}
+
+	var frame struct {
+		Type  string `json:"type"`
+		Calls []struct {
+			Input hexutil.Bytes `json:"input"`
+		} `json:"calls"`
+	}
+	if err := client.Call(&frame, "debug_traceCall", args, "latest", map[string]interface{}{"tracer": "callTracer"}); err != nil {
+		t.Fatalf("debug_traceCall failed: %v", err)
+	}
+	if frame.Type != "CALL" || len(frame.Calls) != 1 || common.BytesToHash(frame.Calls[0].Input) != common.HexToHash("0x2b") {
+		t.Errorf("call trace mismatch: %+v", frame)
+	}
+	// Calls on top of the genesis see the initial state, the struct logger is
+	// the default tracer.
+	var res json.RawMessage
+	if err := client.Call(&res, "debug_traceCall", args, "earliest"); err != nil {
+		t.Fatalf("debug_traceCall failed: %v", err)
+	}
+	var result vm.ExecutionResult
+	if err := json.Unmarshal(res, &result); err != nil || result.Failed || len(result.StructLogs) == 0 {
+		t.Errorf("struct logger result mismatch: %s", res)
+	}
+	if err := client.Call(&res, "debug_traceCall", args, "pending"); err == nil {
+		t.Errorf("trace on pending accepted")
+	}
+	if err := client.Call(&res, "debug_traceCall", args, "0x5"); err == nil {
+		t.Errorf("trace on unknown block accepted")
+	}
+}
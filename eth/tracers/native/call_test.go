@@ -0,0 +1,96 @@
+package native
+
+import (
+	"encoding/json"
+	"errors"
+	"ethereum-evm/common/hexutil"
+	"ethereum-evm/core/vm"
+	"math/big"
+	"testing"
+
+	"github.com/ethereum/go-ethereum/common"
+)
+
+func TestCallTracerNestedFrames(t *testing.T) {
+	tracer, err := NewCallTracer(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var (
+		from   = common.HexToAddress("0x01")
+		to     = common.HexToAddress("0x02")
+		callee = common.HexToAddress("0x03")
+		// Error(string) with message "nope"
+		revert = hexutil.MustDecode("0x08c379a0000000000000000000000000000000000000000000000000000000000000002000000000000000000000000000000000000000000000000000000000000000046e6f706500000000000000000000000000000000000000000000000000000000")
+	)
+	tracer.CaptureStart(nil, from, to, false, []byte{0xca, 0xfe}, 100000, big.NewInt(0))
+	tracer.CaptureEnter(vm.STATICCALL, to, callee, nil, 5000, nil)
+	tracer.CaptureExit(revert, 300, vm.ErrExecutionReverted)
+	tracer.CaptureEnd([]byte{0x01}, 21000, 0, nil)
+
+	res, err := tracer.GetResult()
+	if err != nil {
+		t.Fatal(err)
+	}
+	var have map[string]interface{}
+	if err := json.Unmarshal(res, &have); err != nil {
+		t.Fatal(err)
+	}
+	if have["type"] != "CALL" || have["gasUsed"] != "0x5208" || have["output"] != "0x01" {
+		t.Errorf("unexpected top frame: %s", res)
+	}
+	calls, ok := have["calls"].([]interface{})
+	if !ok || len(calls) != 1 {
+		t.Fatalf("expected one child frame: %s", res)
+	}
+	child := calls[0].(map[string]interface{})
+	if child["type"] != "STATICCALL" || child["error"] != "execution reverted" || child["revertReason"] != "nope" {
+		t.Errorf("unexpected child frame: %v", child)
+	}
+}
+
+func TestCallTracerOnlyTopCall(t *testing.T) {
+	tracer, err := NewCallTracer(json.RawMessage(`{"onlyTopCall":true}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	tracer.CaptureStart(nil, common.Address{}, common.Address{}, true, nil, 100, nil)
+	tracer.CaptureEnter(vm.CREATE2, common.Address{}, common.Address{}, nil, 50, nil)
+	tracer.CaptureExit(nil, 10, nil)
+	tracer.CaptureEnd(nil, 60, 0, nil)
+
+	res, err := tracer.GetResult()
+	if err != nil {
+		t.Fatal(err)
+	}
+	var have callFrame
+	if err := json.Unmarshal(res, &have); err != nil {
+		t.Fatal(err)
+	}
+	if len(have.Calls) != 0 {
+		t.Errorf("expected no child frames, have %d", len(have.Calls))
+	}
+}
+
+func TestCallTracerInterrupted(t *testing.T) {
+	tracer, err := NewCallTracer(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tracer.CaptureStart(nil, common.Address{}, common.HexToAddress("0x01"), false, nil, 100000, big.NewInt(0))
+	tracer.CaptureEnter(vm.CALL, common.HexToAddress("0x01"), common.HexToAddress("0x02"), nil, 5000, big.NewInt(0))
+	tracer.Stop(errors.New("timeout"))
+
+	// Scopes opened after the interruption are skipped, and so are their exits,
+	// leaving the open frame untouched.
+	tracer.CaptureEnter(vm.CALL, common.HexToAddress("0x02"), common.HexToAddress("0x03"), nil, 1000, big.NewInt(0))
+	tracer.CaptureExit(nil, 700, nil)
+
+	ct := tracer.(*callTracer)
+	if len(ct.callstack) != 2 {
+		t.Fatalf("call stack size mismatch: have %d, want 2", len(ct.callstack))
+	}
+	if frame := ct.callstack[1]; frame.Gas != 5000 || frame.GasUsed != 0 || len(ct.callstack[0].Calls) != 0 {
+		t.Errorf("open frame modified after interruption: %+v", frame)
+	}
+}
@@ -0,0 +1,55 @@
+// Copyright 2017 The go-ethereum Authors
+// This file is part of the go-ethereum library.
+//
+// The go-ethereum library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-ethereum library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-ethereum library. If not, see <http://www.gnu.org/licenses/>.
+
+// Package tracers is a collection of EVM tracers which collect a result out
+// of the execution of a transaction or call.
+package tracers
+
+import (
+	"encoding/json"
+	"errors"
+	"ethereum-evm/core/vm"
+)
+
+// Tracer interface extends vm.Tracer and additionally
+// allows collecting the tracing result.
+type Tracer interface {
+	vm.Tracer
+	GetResult() (json.RawMessage, error)
+	// Stop terminates execution of the tracer at the first opportune moment.
+	Stop(err error)
+}
+
+// ctorFn is the constructor signature of a tracer, cfg holds the tracer
+// specific options and may be nil.
+type ctorFn func(cfg json.RawMessage) (Tracer, error)
+
+// lookup maps the names of the registered tracers to their constructors.
+var lookup = make(map[string]ctorFn)
+
+// Register makes a tracer available by name. It is meant to be called from
+// the init functions of the packages implementing tracers.
+func Register(name string, ctor ctorFn) {
+	lookup[name] = ctor
+}
+
+// New creates the tracer registered under name, configured by cfg.
+func New(name string, cfg json.RawMessage) (Tracer, error) {
+	if ctor, ok := lookup[name]; ok {
+		return ctor(cfg)
+	}
+	return nil, errors.New("tracer not found")
+}
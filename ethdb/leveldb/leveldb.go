@@ -34,6 +34,7 @@ import (
 	"github.com/syndtr/goleveldb/leveldb/errors"
 	"github.com/syndtr/goleveldb/leveldb/filter"
 	"github.com/syndtr/goleveldb/leveldb/opt"
+	"github.com/syndtr/goleveldb/leveldb/storage"
 	"github.com/syndtr/goleveldb/leveldb/util"
 )
 
@@ -125,10 +126,9 @@ func NewCustom(file string, namespace string, customize func(options *opt.Option
 	}
 	// Assemble the wrapper with all the registered metrics
 	ldb := &Database{
-		fn:       file,
-		db:       db,
-		log:      logger,
-		quitChan: make(chan chan error),
+		fn:  file,
+		db:  db,
+		log: logger,
 	}
 	// ldb.compTimeMeter = metrics.NewRegisteredMeter(namespace+"compact/time", nil)
 	// ldb.compReadMeter = metrics.NewRegisteredMeter(namespace+"compact/input", nil)
@@ -143,11 +143,27 @@ func NewCustom(file string, namespace string, customize func(options *opt.Option
 	// ldb.nonlevel0CompGauge = metrics.NewRegisteredGauge(namespace+"compact/nonlevel0", nil)
 	// ldb.seekCompGauge = metrics.NewRegisteredGauge(namespace+"compact/seek", nil)
 
-	// Start up the metrics gathering and return
+	// Start up the metrics gathering and return. Close only waits for the
+	// collector if quitChan is set, so it has to be created along with it.
+	// ldb.quitChan = make(chan chan error)
 	// go ldb.meter(metricsGatheringInterval)
 	return ldb, nil
 }
 
+// NewMemory returns a wrapped LevelDB object that keeps all of its data in
+// memory. Nothing is written to disk, the contents are lost on Close.
+func NewMemory() (*Database, error) {
+	db, err := leveldb.Open(storage.NewMemStorage(), configureOptions(nil))
+	if err != nil {
+		return nil, err
+	}
+	return &Database{
+		fn:  "memory",
+		db:  db,
+		log: log.New("database", "memory"),
+	}, nil
+}
+
 // configureOptions sets some default options, then runs the provided setter.
 func configureOptions(customizeFn func(*opt.Options)) *opt.Options {
 	// Set default options
@@ -17,10 +17,10 @@
 package leveldb
 
 import (
+	"ethereum-evm/ethdb"
+	"ethereum-evm/ethdb/dbtest"
 	"testing"
 
-	"github.com/ethereum/go-ethereum/ethdb"
-	"github.com/ethereum/go-ethereum/ethdb/dbtest"
 	"github.com/syndtr/goleveldb/leveldb"
 	"github.com/syndtr/goleveldb/leveldb/storage"
 )
@@ -37,4 +37,13 @@ func TestLevelDB(t *testing.T) {
 			}
 		})
 	})
+	t.Run("MemorySuite", func(t *testing.T) {
+		dbtest.TestDatabaseSuite(t, func() ethdb.KeyValueStore {
+			db, err := NewMemory()
+			if err != nil {
+				t.Fatal(err)
+			}
+			return db
+		})
+	})
 }
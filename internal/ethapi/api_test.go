@@ -0,0 +1,467 @@
+package ethapi
+
+import (
+	"context"
+	"errors"
+	"ethereum-evm/common/hexutil"
+	"ethereum-evm/core"
+	"ethereum-evm/core/rawdb"
+	"ethereum-evm/core/vm"
+	"ethereum-evm/eth"
+	"ethereum-evm/miner"
+	"ethereum-evm/params"
+	"math/big"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/crypto"
+	"github.com/ethereum/go-ethereum/rpc"
+)
+
+var (
+	testAccount  = common.HexToAddress("0x1000")
+	testContract = common.HexToAddress("0x2000")
+	testReverter = common.HexToAddress("0x3000")
+
+	testKey, _ = crypto.HexToECDSA("b71c71a67e1177ad4e901695e1b4b9ee17ae16c6668d313eac2f96dbcda3f291")
+	testFunded = crypto.PubkeyToAddress(testKey.PublicKey)
+)
+
+// newTestBackend creates a development chain whose genesis holds the test
+// accounts and contracts.
+func newTestBackend(t *testing.T) Backend {
+	genesis := &core.Genesis{
+		Config:   params.TestChainConfig,
+		GasLimit: 30000000,
+		BaseFee:  big.NewInt(params.InitialBaseFee),
+		Alloc: core.GenesisAlloc{
+			testAccount: {Balance: big.NewInt(1000)},
+			testFunded:  {Balance: new(big.Int).Exp(big.NewInt(10), big.NewInt(18), nil)},
+			// SSTORE(0, CALLDATALOAD(0)), then return the value of slot 1:
+			// PUSH1 0 CALLDATALOAD PUSH1 0 SSTORE PUSH1 1 SLOAD PUSH1 0 MSTORE PUSH1 32 PUSH1 0 RETURN
+			testContract: {
+				Nonce:   1,
+				Code:    common.FromHex("60003560005560015460005260206000f3"),
+				Storage: map[common.Hash]common.Hash{common.HexToHash("0x01"): common.HexToHash("0xbeef")},
+			},
+			// Store the ABI encoding of Error("boom") word by word and revert with it.
+			testReverter: {
+				Code: common.FromHex(
+					"7f08c379a000000000000000000000000000000000000000000000000000000000600052" +
+						"7f0000000000000000000000000000000000000000000000000000000000000020600452" +
+						"7f0000000000000000000000000000000000000000000000000000000000000004602452" +
+						"7f626f6f6d00000000000000000000000000000000000000000000000000000000604452" +
+						"60646000fd"),
+			},
+		},
+	}
+	chain, err := core.NewBlockChain(rawdb.NewMemoryDatabase(), genesis, vm.Config{})
+	if err != nil {
+		t.Fatalf("failed to create chain: %v", err)
+	}
+	return eth.NewEthAPIBackend(chain, miner.New(chain, common.HexToAddress("0xc0ffee")), 25000000)
+}
+
+// newTestClient starts a JSON-RPC server over HTTP on top of the test backend.
+func newTestClient(t *testing.T) *rpc.Client {
+	server, err := NewServer(GetAPIs(newTestBackend(t)))
+	if err != nil {
+		t.Fatalf("failed to create server: %v", err)
+	}
+	httpsrv := httptest.NewServer(server)
+	client, err := rpc.DialHTTP(httpsrv.URL)
+	if err != nil {
+		t.Fatalf("failed to dial server: %v", err)
+	}
+	t.Cleanup(func() {
+		client.Close()
+		httpsrv.Close()
+		server.Stop()
+	})
+	return client
+}
+
+func TestStateReads(t *testing.T) {
+	client := newTestClient(t)
+
+	var chainID hexutil.Big
+	if err := client.Call(&chainID, "eth_chainId"); err != nil {
+		t.Fatalf("eth_chainId failed: %v", err)
+	}
+	if chainID.ToInt().Cmp(params.TestChainConfig.ChainID) != 0 {
+		t.Errorf("chain id mismatch: have %v, want %v", chainID.ToInt(), params.TestChainConfig.ChainID)
+	}
+	var balance hexutil.Big
+	if err := client.Call(&balance, "eth_getBalance", testAccount, "latest"); err != nil {
+		t.Fatalf("eth_getBalance failed: %v", err)
+	}
+	if balance.ToInt().Int64() != 1000 {
+		t.Errorf("balance mismatch: have %v, want 1000", balance.ToInt())
+	}
+	var code hexutil.Bytes
+	if err := client.Call(&code, "eth_getCode", testContract, "latest"); err != nil {
+		t.Fatalf("eth_getCode failed: %v", err)
+	}
+	if len(code) != 17 {
+		t.Errorf("code length mismatch: have %d, want 17", len(code))
+	}
+	// Storage keys may be shorter than 32 bytes.
+	var value hexutil.Bytes
+	if err := client.Call(&value, "eth_getStorageAt", testContract, "0x1", "pending"); err != nil {
+		t.Fatalf("eth_getStorageAt failed: %v", err)
+	}
+	if common.BytesToHash(value) != common.HexToHash("0xbeef") {
+		t.Errorf("storage mismatch: have %x, want beef", value)
+	}
+	if err := client.Call(&value, "eth_getStorageAt", testContract, "0xzz", "latest"); err == nil {
+		t.Errorf("invalid storage key accepted")
+	}
+	if err := client.Call(&balance, "eth_getBalance", testAccount, "0x5"); err == nil {
+		t.Errorf("unknown block accepted")
+	}
+}
+
+func TestCall(t *testing.T) {
+	client := newTestClient(t)
+	input := hexutil.Bytes(common.HexToHash("0x2a").Bytes())
+
+	var ret hexutil.Bytes
+	if err := client.Call(&ret, "eth_call", TransactionArgs{To: &testContract, Input: &input}, "latest"); err != nil {
+		t.Fatalf("eth_call failed: %v", err)
+	}
+	if common.BytesToHash(ret) != common.HexToHash("0xbeef") {
+		t.Errorf("return value mismatch: have %x, want beef", ret)
+	}
+	// Calls don't change the state.
+	var value hexutil.Bytes
+	if err := client.Call(&value, "eth_getStorageAt", testContract, "0x0", "latest"); err != nil {
+		t.Fatalf("eth_getStorageAt failed: %v", err)
+	}
+	if common.BytesToHash(value) != (common.Hash{}) {
+		t.Errorf("call modified the state: slot 0 is %x", value)
+	}
+	// Reverts carry the reason in the message and the raw data in the error.
+	err := client.Call(&ret, "eth_call", TransactionArgs{To: &testReverter}, "latest")
+	if err == nil || err.Error() != "execution reverted: boom" {
+		t.Fatalf("revert error mismatch: have %v, want execution reverted: boom", err)
+	}
+	var dataErr rpc.DataError
+	if !errors.As(err, &dataErr) || len(dataErr.ErrorData().(string)) != 2+2*100 {
+		t.Errorf("revert data missing: %v", dataErr)
+	}
+	// Legacy and 1559 fee fields can't be mixed.
+	price := (*hexutil.Big)(big.NewInt(1))
+	if err := client.Call(&ret, "eth_call", TransactionArgs{To: &testContract, GasPrice: price, MaxFeePerGas: price}, "latest"); err == nil {
+		t.Errorf("mixed fee fields accepted")
+	}
+}
+
+func TestEstimateGas(t *testing.T) {
+	client := newTestClient(t)
+	value := (*hexutil.Big)(big.NewInt(1))
+
+	var gas hexutil.Uint64
+	if err := client.Call(&gas, "eth_estimateGas", TransactionArgs{From: &testAccount, To: &testContract, Value: value}); err != nil {
+		t.Fatalf("eth_estimateGas failed: %v", err)
+	}
+	// Intrinsic gas plus the cold sload of slot 1 and the execution.
+	if uint64(gas) < params.TxGas+params.ColdSloadCostEIP2929 {
+		t.Errorf("estimate too low: %d", gas)
+	}
+	// Reverts carry the reason like eth_call does.
+	err := client.Call(&gas, "eth_estimateGas", TransactionArgs{To: &testReverter})
+	if err == nil || err.Error() != "execution reverted: boom" {
+		t.Errorf("revert error mismatch: have %v, want execution reverted: boom", err)
+	}
+	var dataErr rpc.DataError
+	if !errors.As(err, &dataErr) || len(dataErr.ErrorData().(string)) != 2+2*100 {
+		t.Errorf("revert data missing: %v", dataErr)
+	}
+	// Transfers from accounts without funds fail.
+	if err := client.Call(&gas, "eth_estimateGas", TransactionArgs{To: &testAccount, Value: value}, "latest"); err == nil {
+		t.Errorf("unfunded transfer estimated")
+	}
+}
+
+func TestSendRawTransaction(t *testing.T) {
+	client := newTestClient(t)
+	signer := types.LatestSignerForChainID(params.TestChainConfig.ChainID)
+	input := hexutil.Bytes(common.HexToHash("0x2a").Bytes())
+
+	tx := types.MustSignNewTx(testKey, signer, &types.DynamicFeeTx{
+		ChainID:   params.TestChainConfig.ChainID,
+		Nonce:     0,
+		GasTipCap: big.NewInt(1),
+		GasFeeCap: big.NewInt(2 * params.InitialBaseFee),
+		Gas:       100000,
+		To:        &testContract,
+		Data:      input,
+	})
+	raw, err := tx.MarshalBinary()
+	if err != nil {
+		t.Fatalf("failed to encode transaction: %v", err)
+	}
+	var hash common.Hash
+	if err := client.Call(&hash, "eth_sendRawTransaction", hexutil.Bytes(raw)); err != nil {
+		t.Fatalf("eth_sendRawTransaction failed: %v", err)
+	}
+	if hash != tx.Hash() {
+		t.Errorf("transaction hash mismatch: have %x, want %x", hash, tx.Hash())
+	}
+	// The transaction is sealed into a block of its own right away.
+	var number hexutil.Uint64
+	if err := client.Call(&number, "eth_blockNumber"); err != nil {
+		t.Fatalf("eth_blockNumber failed: %v", err)
+	}
+	if number != 1 {
+		t.Errorf("block number mismatch: have %d, want 1", number)
+	}
+	var receipt map[string]interface{}
+	if err := client.Call(&receipt, "eth_getTransactionReceipt", hash); err != nil {
+		t.Fatalf("eth_getTransactionReceipt failed: %v", err)
+	}
+	if receipt["status"] != "0x1" || receipt["blockNumber"] != "0x1" || receipt["transactionIndex"] != "0x0" {
+		t.Errorf("receipt mismatch: %v", receipt)
+	}
+	var block map[string]interface{}
+	if err := client.Call(&block, "eth_getBlockByNumber", "latest", false); err != nil {
+		t.Fatalf("eth_getBlockByNumber failed: %v", err)
+	}
+	if block["hash"] != receipt["blockHash"] || block["gasUsed"] != receipt["gasUsed"] {
+		t.Errorf("block doesn't match receipt: %v", block)
+	}
+	if txs := block["transactions"].([]interface{}); len(txs) != 1 || txs[0] != hash.Hex() {
+		t.Errorf("block transactions mismatch: %v", txs)
+	}
+	var nonce hexutil.Uint64
+	if err := client.Call(&nonce, "eth_getTransactionCount", testFunded, "latest"); err != nil {
+		t.Fatalf("eth_getTransactionCount failed: %v", err)
+	}
+	if nonce != 1 {
+		t.Errorf("nonce mismatch: have %d, want 1", nonce)
+	}
+	var value hexutil.Bytes
+	if err := client.Call(&value, "eth_getStorageAt", testContract, "0x0", "latest"); err != nil {
+		t.Fatalf("eth_getStorageAt failed: %v", err)
+	}
+	if common.BytesToHash(value) != common.HexToHash("0x2a") {
+		t.Errorf("storage mismatch: have %x, want 2a", value)
+	}
+	// The genesis state is still served for earlier blocks.
+	if err := client.Call(&value, "eth_getStorageAt", testContract, "0x0", "earliest"); err != nil {
+		t.Fatalf("eth_getStorageAt failed: %v", err)
+	}
+	if common.BytesToHash(value) != (common.Hash{}) {
+		t.Errorf("genesis storage mismatch: have %x", value)
+	}
+	// Replayed transactions are rejected without producing a block.
+	if err := client.Call(&hash, "eth_sendRawTransaction", hexutil.Bytes(raw)); err == nil {
+		t.Errorf("replayed transaction accepted")
+	}
+	if err := client.Call(&number, "eth_blockNumber"); err != nil || number != 1 {
+		t.Errorf("block number mismatch after replay: have %d, want 1 (%v)", number, err)
+	}
+	if err := client.Call(&block, "eth_getBlockByNumber", "0x2", false); err != nil || block != nil {
+		t.Errorf("unknown block returned: %v (%v)", block, err)
+	}
+}
+
+func TestCallOverrides(t *testing.T) {
+	client := newTestClient(t)
+
+	// ADDRESS BALANCE PUSH1 0 MSTORE PUSH1 32 PUSH1 0 RETURN
+	balanceCode := hexutil.Bytes(common.FromHex("303160005260206000f3"))
+	balance := (*hexutil.Big)(big.NewInt(1234))
+	overrides := StateOverride{testAccount: {Code: &balanceCode, Balance: balance}}
+
+	var ret hexutil.Bytes
+	if err := client.Call(&ret, "eth_call", TransactionArgs{To: &testAccount}, "latest", overrides); err != nil {
+		t.Fatalf("eth_call failed: %v", err)
+	}
+	if common.BytesToHash(ret).Big().Int64() != 1234 {
+		t.Errorf("overridden balance mismatch: have %x, want 1234", ret)
+	}
+	// NUMBER PUSH1 0 MSTORE PUSH1 32 PUSH1 0 RETURN
+	numberCode := hexutil.Bytes(common.FromHex("4360005260206000f3"))
+	overrides = StateOverride{testAccount: {Code: &numberCode}}
+	blockOverrides := &BlockOverrides{Number: (*hexutil.Big)(big.NewInt(100))}
+	if err := client.Call(&ret, "eth_call", TransactionArgs{To: &testAccount}, "latest", overrides, blockOverrides); err != nil {
+		t.Fatalf("eth_call failed: %v", err)
+	}
+	if common.BytesToHash(ret).Big().Int64() != 100 {
+		t.Errorf("overridden number mismatch: have %x, want 100", ret)
+	}
+	// Full and partial storage overrides can't be mixed.
+	storage := map[common.Hash]common.Hash{}
+	overrides = StateOverride{testContract: {State: &storage, StateDiff: &storage}}
+	if err := client.Call(&ret, "eth_call", TransactionArgs{To: &testContract}, "latest", overrides); err == nil {
+		t.Errorf("mixed storage overrides accepted")
+	}
+}
+
+func TestSimulateV1(t *testing.T) {
+	client := newTestClient(t)
+
+	var (
+		emitter = common.HexToAddress("0x4000")
+		// NUMBER PUSH1 0 MSTORE PUSH1 32 PUSH1 0 LOG0
+		emitterCode = hexutil.Bytes(common.FromHex("4360005260206000a0"))
+		coinbase    = common.HexToAddress("0xc0ffee")
+		input       = hexutil.Bytes(common.HexToHash("0x2a").Bytes())
+		storage     = map[common.Hash]common.Hash{common.HexToHash("0x01"): common.HexToHash("0x01")}
+	)
+	opts := SimOpts{
+		BlockStateCalls: []SimBlock{
+			{
+				BlockOverrides: &BlockOverrides{Number: (*hexutil.Big)(big.NewInt(16)), Coinbase: &coinbase},
+				StateOverrides: &StateOverride{emitter: {Code: &emitterCode}},
+				Calls: []TransactionArgs{
+					{From: &testAccount, To: &testContract, Input: &input},
+					{From: &testAccount, To: &testReverter},
+					{From: &testAccount, To: &emitter},
+				},
+			},
+			{
+				// Replace the storage written by the first block.
+				StateOverrides: &StateOverride{testContract: {State: &storage}},
+				Calls: []TransactionArgs{
+					{From: &testAccount, To: &testContract, Input: &input},
+					{From: &testAccount, To: &emitter},
+				},
+			},
+		},
+	}
+	var results []struct {
+		Number       hexutil.Uint64 `json:"number"`
+		Hash         common.Hash    `json:"hash"`
+		Miner        common.Address `json:"miner"`
+		Timestamp    hexutil.Uint64 `json:"timestamp"`
+		GasUsed      hexutil.Uint64 `json:"gasUsed"`
+		Transactions []common.Hash  `json:"transactions"`
+		Calls        []struct {
+			ReturnData hexutil.Bytes  `json:"returnData"`
+			Logs       []*types.Log   `json:"logs"`
+			GasUsed    hexutil.Uint64 `json:"gasUsed"`
+			Status     hexutil.Uint64 `json:"status"`
+			Error      *CallError     `json:"error"`
+		} `json:"calls"`
+	}
+	if err := client.Call(&results, "eth_simulateV1", opts, "latest"); err != nil {
+		t.Fatalf("eth_simulateV1 failed: %v", err)
+	}
+	if len(results) != 2 {
+		t.Fatalf("block count mismatch: have %d, want 2", len(results))
+	}
+	first, second := results[0], results[1]
+	if first.Number != 16 || first.Miner != coinbase || len(first.Transactions) != 3 || len(first.Calls) != 3 {
+		t.Fatalf("first block mismatch: %+v", first)
+	}
+	if common.BytesToHash(first.Calls[0].ReturnData) != common.HexToHash("0xbeef") || first.Calls[0].Status != 1 {
+		t.Errorf("first call mismatch: %+v", first.Calls[0])
+	}
+	if call := first.Calls[1]; call.Status != 0 || call.Error == nil || call.Error.Code != 3 || call.Error.Message != "execution reverted: boom" {
+		t.Errorf("reverting call mismatch: %+v", call)
+	}
+	var gasUsed uint64
+	for _, call := range first.Calls {
+		gasUsed += uint64(call.GasUsed)
+	}
+	if uint64(first.GasUsed) != gasUsed {
+		t.Errorf("block gas used mismatch: have %d, want %d", first.GasUsed, gasUsed)
+	}
+	if logs := first.Calls[2].Logs; len(logs) != 1 || common.BytesToHash(logs[0].Data) != common.BigToHash(big.NewInt(16)) ||
+		logs[0].BlockHash != first.Hash || logs[0].TxHash != first.Transactions[2] || logs[0].Index != 0 {
+		t.Errorf("log mismatch: %v", logs)
+	}
+	// The second block follows the first one.
+	if second.Number != 17 || second.Timestamp <= first.Timestamp || second.Miner != coinbase {
+		t.Errorf("second block mismatch: %+v", second)
+	}
+	if common.BytesToHash(second.Calls[0].ReturnData) != common.HexToHash("0x01") {
+		t.Errorf("storage override mismatch: have %x, want 01", second.Calls[0].ReturnData)
+	}
+	if logs := second.Calls[1].Logs; len(logs) != 1 || common.BytesToHash(logs[0].Data) != common.BigToHash(big.NewInt(17)) || logs[0].Index != 0 {
+		t.Errorf("second block log mismatch: %v", logs)
+	}
+	// The chain is left untouched.
+	var number hexutil.Uint64
+	if err := client.Call(&number, "eth_blockNumber"); err != nil || number != 0 {
+		t.Errorf("block number mismatch: have %d, want 0 (%v)", number, err)
+	}
+	var value hexutil.Bytes
+	if err := client.Call(&value, "eth_getStorageAt", testContract, "0x0", "latest"); err != nil {
+		t.Fatalf("eth_getStorageAt failed: %v", err)
+	}
+	if common.BytesToHash(value) != (common.Hash{}) {
+		t.Errorf("simulation modified the state: slot 0 is %x", value)
+	}
+	// Blocks must be in order.
+	opts.BlockStateCalls[1].BlockOverrides = &BlockOverrides{Number: (*hexutil.Big)(big.NewInt(16))}
+	if err := client.Call(&results, "eth_simulateV1", opts, "latest"); err == nil {
+		t.Errorf("out of order blocks accepted")
+	}
+}
+
+func TestSimulateSameCallFromDifferentSenders(t *testing.T) {
+	b := newTestBackend(t)
+	statedb, header, err := b.StateAndHeaderByNumberOrHash(context.Background(), rpc.BlockNumberOrHashWithNumber(rpc.LatestBlockNumber))
+	if err != nil {
+		t.Fatalf("failed to open state: %v", err)
+	}
+	var (
+		emitter = common.HexToAddress("0x4000")
+		// PUSH1 0 PUSH1 0 LOG0
+		emitterCode = hexutil.Bytes(common.FromHex("60006000a0"))
+		senders     = []common.Address{common.HexToAddress("0x6000"), common.HexToAddress("0x7000")}
+		gas         = hexutil.Uint64(100000)
+	)
+	opts := &SimOpts{BlockStateCalls: []SimBlock{{
+		StateOverrides: &StateOverride{emitter: {Code: &emitterCode}},
+		Calls: []TransactionArgs{
+			{From: &senders[0], To: &emitter, Gas: &gas},
+			{From: &senders[1], To: &emitter, Gas: &gas},
+		},
+	}}}
+	results, err := Simulate(context.Background(), b.ChainConfig(), nil, statedb, header, opts, 0)
+	if err != nil {
+		t.Fatalf("simulation failed: %v", err)
+	}
+	txs := results[0].Block.Transactions()
+	if txs[0].Hash() == txs[1].Hash() {
+		t.Errorf("calls from different senders share the hash %x", txs[0].Hash())
+	}
+	for i, call := range results[0].Calls {
+		if len(call.Logs) != 1 || call.Logs[0].TxHash != txs[i].Hash() {
+			t.Errorf("call %d: log mismatch: %v", i, call.Logs)
+		}
+	}
+}
+
+func TestSimulateGasBudget(t *testing.T) {
+	b := newTestBackend(t)
+	statedb, header, err := b.StateAndHeaderByNumberOrHash(context.Background(), rpc.BlockNumberOrHashWithNumber(rpc.LatestBlockNumber))
+	if err != nil {
+		t.Fatalf("failed to open state: %v", err)
+	}
+	var (
+		to  = common.HexToAddress("0x5000")
+		gas = hexutil.Uint64(100000)
+	)
+	// The first transfer uses up the whole budget, the explicit gas limit of
+	// the second call must not get around it.
+	opts := &SimOpts{BlockStateCalls: []SimBlock{{
+		Calls: []TransactionArgs{
+			{From: &testFunded, To: &to},
+			{From: &testFunded, To: &testContract, Gas: &gas},
+		},
+	}}}
+	if _, err := Simulate(context.Background(), b.ChainConfig(), nil, statedb, header, opts, params.TxGas); err == nil {
+		t.Errorf("call beyond the gas budget simulated")
+	}
+	opts.BlockStateCalls[0].Calls = opts.BlockStateCalls[0].Calls[:1]
+	if _, err := Simulate(context.Background(), b.ChainConfig(), nil, statedb, header, opts, params.TxGas); err != nil {
+		t.Errorf("call within the gas budget failed: %v", err)
+	}
+}
@@ -0,0 +1,78 @@
+// Copyright 2015 The go-ethereum Authors
+// This file is part of the go-ethereum library.
+//
+// The go-ethereum library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-ethereum library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-ethereum library. If not, see <http://www.gnu.org/licenses/>.
+
+// Package ethapi implements the general Ethereum API functions.
+package ethapi
+
+import (
+	"context"
+	"ethereum-evm/core/state"
+	"ethereum-evm/params"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/rpc"
+)
+
+// Backend interface provides the common API services (that are provided by
+// both full and light clients) with access to necessary functions.
+type Backend interface {
+	ChainConfig() *params.ChainConfig
+	RPCGasCap() uint64 // global gas cap for eth_call over rpc: DoS protection
+
+	// Blockchain API
+	CurrentHeader() *types.Header
+	HeaderByNumber(ctx context.Context, number rpc.BlockNumber) (*types.Header, error)
+	HeaderByHash(ctx context.Context, hash common.Hash) (*types.Header, error)
+	BlockByNumber(ctx context.Context, number rpc.BlockNumber) (*types.Block, error)
+	BlockByHash(ctx context.Context, hash common.Hash) (*types.Block, error)
+	GetReceipts(ctx context.Context, hash common.Hash) (types.Receipts, error)
+
+	// StateAndHeaderByNumberOrHash returns a mutable copy of the state at the
+	// given block together with the header of that block.
+	StateAndHeaderByNumberOrHash(ctx context.Context, blockNrOrHash rpc.BlockNumberOrHash) (*state.StateDB, *types.Header, error)
+
+	// Transaction API
+	SendTx(ctx context.Context, signedTx *types.Transaction) error
+	GetTransaction(ctx context.Context, txHash common.Hash) (*types.Transaction, common.Hash, uint64, uint64, error)
+}
+
+// GetAPIs returns the APIs served on top of the given backend.
+func GetAPIs(b Backend) []rpc.API {
+	return []rpc.API{
+		{
+			Namespace: "eth",
+			Service:   NewBlockChainAPI(b),
+		}, {
+			Namespace: "eth",
+			Service:   NewTransactionAPI(b),
+		},
+	}
+}
+
+// NewServer creates a JSON-RPC server with the given APIs registered, usually
+// those of GetAPIs together with the APIs of other packages serving the same
+// backend. The server is an http.Handler speaking JSON-RPC 2.0 over HTTP.
+func NewServer(apis []rpc.API) (*rpc.Server, error) {
+	server := rpc.NewServer()
+	for _, api := range apis {
+		if err := server.RegisterName(api.Namespace, api.Service); err != nil {
+			server.Stop()
+			return nil, err
+		}
+	}
+	return server, nil
+}
@@ -0,0 +1,381 @@
+// Copyright 2023 The go-ethereum Authors
+// This file is part of the go-ethereum library.
+//
+// The go-ethereum library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-ethereum library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-ethereum library. If not, see <http://www.gnu.org/licenses/>.
+
+package ethapi
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"ethereum-evm/common/hexutil"
+	"ethereum-evm/consensus/misc"
+	"ethereum-evm/core"
+	"ethereum-evm/core/state"
+	"ethereum-evm/core/vm"
+	"ethereum-evm/params"
+	"ethereum-evm/trie"
+	"fmt"
+	"math/big"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/crypto"
+	"github.com/ethereum/go-ethereum/rpc"
+)
+
+const (
+	// maxSimulateBlocks is the maximum number of blocks that can be simulated
+	// in a single request.
+	maxSimulateBlocks = 256
+
+	// timestampIncrement is the default increment between block timestamps.
+	timestampIncrement = 12
+
+	// errCodeVMError is the JSON error code of calls failing in the EVM for
+	// reasons other than a revert.
+	errCodeVMError = -32015
+)
+
+// SimBlock is a batch of calls to be simulated sequentially in a block, on
+// top of the given state and block overrides.
+type SimBlock struct {
+	BlockOverrides *BlockOverrides   `json:"blockOverrides"`
+	StateOverrides *StateOverride    `json:"stateOverrides"`
+	Calls          []TransactionArgs `json:"calls"`
+}
+
+// SimOpts are the inputs to eth_simulateV1.
+type SimOpts struct {
+	BlockStateCalls []SimBlock `json:"blockStateCalls"`
+}
+
+// SimCallResult is the result of a simulated call.
+type SimCallResult struct {
+	ReturnValue hexutil.Bytes  `json:"returnData"`
+	Logs        []*types.Log   `json:"logs"`
+	GasUsed     hexutil.Uint64 `json:"gasUsed"`
+	Status      hexutil.Uint64 `json:"status"`
+	Error       *CallError     `json:"error,omitempty"`
+}
+
+// CallError is the failure of a simulated call that made it into the block,
+// a revert or another EVM error.
+type CallError struct {
+	Message string `json:"message"`
+	Code    int    `json:"code"`
+	Data    string `json:"data,omitempty"`
+}
+
+// SimBlockResult is a simulated block together with the results of its calls.
+type SimBlockResult struct {
+	Block *types.Block
+	Calls []SimCallResult
+
+	config *params.ChainConfig
+}
+
+// MarshalJSON encodes the block like eth_getBlockByNumber does with
+// transaction hashes only, adding the results of the calls.
+func (r *SimBlockResult) MarshalJSON() ([]byte, error) {
+	fields, err := RPCMarshalBlock(r.Block, true, false, r.config)
+	if err != nil {
+		return nil, err
+	}
+	fields["calls"] = r.Calls
+	return json.Marshal(fields)
+}
+
+// Simulate executes the calls of every simulated block in order on top of a
+// copy of base, the state after the block with the given parent header, which
+// is left untouched. Each block starts with its state overrides and builds on
+// the state left by the previous one. BLOCKHASH serves the simulated blocks and
+// the ancestors of parent found in chain.
+//
+// By default a block follows the previous one, with its timestamp 12 seconds
+// later and the base fee derived from it. Block numbers and timestamps must
+// increase from one block to the next.
+//
+// Calls run like eth_call does: nonces aren't checked and fees aren't charged
+// unless a gas price is given. Calls failing in the EVM are part of the result,
+// while failures that would make the transaction invalid abort the simulation.
+func Simulate(ctx context.Context, config *params.ChainConfig, chain core.ChainContext, base *state.StateDB, parent *types.Header, opts *SimOpts, gasCap uint64) ([]*SimBlockResult, error) {
+	if len(opts.BlockStateCalls) == 0 {
+		return nil, errors.New("empty input")
+	}
+	if len(opts.BlockStateCalls) > maxSimulateBlocks {
+		return nil, fmt.Errorf("too many blocks, have %d, want at most %d", len(opts.BlockStateCalls), maxSimulateBlocks)
+	}
+	var (
+		statedb  = base.Copy()
+		results  = make([]*SimBlockResult, 0, len(opts.BlockStateCalls))
+		simChain = &simChainContext{chain: chain, headers: make(map[common.Hash]*types.Header)}
+	)
+	if gasCap == 0 {
+		gasCap = ^uint64(0)
+	}
+	for bi, block := range opts.BlockStateCalls {
+		header, err := makeSimHeader(config, parent, block.BlockOverrides)
+		if err != nil {
+			return nil, fmt.Errorf("block %d: %w", bi, err)
+		}
+		if err := block.StateOverrides.Apply(statedb); err != nil {
+			return nil, fmt.Errorf("block %d: %w", bi, err)
+		}
+		result, err := simulateBlock(ctx, config, simChain, statedb, header, block.Calls, &gasCap)
+		if err != nil {
+			return nil, fmt.Errorf("block %d: %w", bi, err)
+		}
+		results = append(results, result)
+		parent = result.Block.Header()
+		simChain.headers[parent.Hash()] = parent
+	}
+	return results, nil
+}
+
+// simChainContext serves the headers of the simulated blocks on top of the
+// ones of the chain.
+type simChainContext struct {
+	chain   core.ChainContext
+	headers map[common.Hash]*types.Header
+}
+
+// GetHeader returns the simulated or chain header with the given hash.
+func (c *simChainContext) GetHeader(hash common.Hash, number uint64) *types.Header {
+	if header, ok := c.headers[hash]; ok {
+		return header
+	}
+	if c.chain == nil {
+		return nil
+	}
+	return c.chain.GetHeader(hash, number)
+}
+
+// makeSimHeader assembles the header of the block following parent, applying
+// the block overrides on top of the defaults.
+func makeSimHeader(config *params.ChainConfig, parent *types.Header, overrides *BlockOverrides) (*types.Header, error) {
+	header := &types.Header{
+		ParentHash: parent.Hash(),
+		Coinbase:   parent.Coinbase,
+		Number:     new(big.Int).Add(parent.Number, common.Big1),
+		GasLimit:   parent.GasLimit,
+		Time:       parent.Time + timestampIncrement,
+		Difficulty: new(big.Int),
+	}
+	if config.IsLondon(header.Number) {
+		header.BaseFee = misc.CalcBaseFee(config, parent)
+	}
+	header = overrides.MakeHeader(header)
+	if header.Number.Cmp(parent.Number) <= 0 {
+		return nil, fmt.Errorf("block numbers must be in order: %d <= %d", header.Number, parent.Number)
+	}
+	if header.Time <= parent.Time {
+		return nil, fmt.Errorf("block timestamps must be in order: %d <= %d", header.Time, parent.Time)
+	}
+	return header, nil
+}
+
+// simulateBlock executes the calls in order on statedb within the given header,
+// and assembles the resulting block. Every call consumes from the gas budget.
+func simulateBlock(ctx context.Context, config *params.ChainConfig, chain core.ChainContext, statedb *state.StateDB, header *types.Header, calls []TransactionArgs, budget *uint64) (*SimBlockResult, error) {
+	var (
+		blockCtx = core.NewEVMBlockContext(header, chain)
+		evm      = vm.NewEVM(blockCtx, vm.TxContext{}, statedb, config, vm.Config{NoBaseFee: true})
+		gp       = new(core.GasPool).AddGas(header.GasLimit)
+		txs      = make(types.Transactions, 0, len(calls))
+		receipts = make(types.Receipts, 0, len(calls))
+		results  = make([]SimCallResult, 0, len(calls))
+		usedGas  uint64
+	)
+	// Monitor the outer context and interrupt the EVM upon cancellation.
+	done := make(chan struct{})
+	defer close(done)
+	go func() {
+		select {
+		case <-ctx.Done():
+			evm.Cancel()
+		case <-done:
+		}
+	}()
+	for i, args := range calls {
+		remaining := gp.Gas()
+		if args.Gas != nil && uint64(*args.Gas) > remaining {
+			return nil, fmt.Errorf("call %d: block gas limit reached: %d > %d", i, *args.Gas, remaining)
+		}
+		// A zero cap means no cap to ToMessage, never let it through.
+		if *budget == 0 {
+			return nil, fmt.Errorf("call %d: gas budget exhausted", i)
+		}
+		if *budget < remaining {
+			remaining = *budget
+		}
+		msg, err := args.ToMessage(remaining, header.BaseFee)
+		if err != nil {
+			return nil, fmt.Errorf("call %d: %w", i, err)
+		}
+		tx := newSimTransaction(config, header, msg, statedb.GetNonce(msg.From))
+		statedb.Prepare(tx.Hash(), i)
+
+		// Logs are numbered in the order they are emitted, the ones of this
+		// call are numbered past the logs emitted before it.
+		logged := uint(len(statedb.Logs()))
+
+		evm.Reset(core.NewEVMTxContext(msg), statedb)
+		result, err := core.ApplyMessage(evm, msg, gp)
+		if err := statedb.Error(); err != nil {
+			return nil, err
+		}
+		// A cancelled execution stops early and looks successful, never trust it.
+		if err := ctx.Err(); err != nil {
+			return nil, err
+		}
+		if err != nil {
+			return nil, fmt.Errorf("call %d: %w", i, err)
+		}
+		if result.UsedGas > *budget {
+			return nil, fmt.Errorf("call %d: gas budget exceeded: %d > %d", i, result.UsedGas, *budget)
+		}
+		statedb.Finalise(config.IsEIP158(header.Number))
+		usedGas += result.UsedGas
+		*budget -= result.UsedGas
+
+		var logs []*types.Log
+		for _, log := range statedb.Logs() {
+			if log.Index >= logged {
+				logs = append(logs, log)
+			}
+		}
+		receipt := &types.Receipt{
+			Type:              tx.Type(),
+			TxHash:            tx.Hash(),
+			GasUsed:           result.UsedGas,
+			CumulativeGasUsed: usedGas,
+			Logs:              logs,
+			TransactionIndex:  uint(i),
+		}
+		if result.Failed() {
+			receipt.Status = types.ReceiptStatusFailed
+		} else {
+			receipt.Status = types.ReceiptStatusSuccessful
+		}
+		receipt.Bloom = types.CreateBloom(types.Receipts{receipt})
+		if msg.To == nil {
+			receipt.ContractAddress = crypto.CreateAddress(msg.From, tx.Nonce())
+		}
+		txs = append(txs, tx)
+		receipts = append(receipts, receipt)
+
+		call := SimCallResult{
+			ReturnValue: result.Return(),
+			Logs:        receipt.Logs,
+			GasUsed:     hexutil.Uint64(result.UsedGas),
+			Status:      hexutil.Uint64(receipt.Status),
+		}
+		if call.Logs == nil {
+			call.Logs = []*types.Log{}
+		}
+		if result.Failed() {
+			call.Error = newCallError(result)
+		}
+		results = append(results, call)
+	}
+	header.GasUsed = usedGas
+	header.Root = statedb.IntermediateRoot(config.IsEIP158(header.Number))
+	block := types.NewBlock(header, txs, nil, receipts, trie.NewStackTrie(nil))
+
+	// The block hash is only known now, stamp it into the receipts and logs.
+	// Logs are numbered across the whole simulation so far, renumber them
+	// from zero within the block.
+	var index uint
+	for _, receipt := range receipts {
+		receipt.BlockHash = block.Hash()
+		receipt.BlockNumber = block.Number()
+		for _, log := range receipt.Logs {
+			log.BlockHash = block.Hash()
+			log.BlockNumber = block.NumberU64()
+			log.Index = index
+			index++
+		}
+	}
+	return &SimBlockResult{Block: block, Calls: results, config: config}, nil
+}
+
+// newSimTransaction returns the unsigned transaction equivalent to msg, used to
+// give the simulated call a hash and a place in the block. Lacking a signature,
+// the sender is carried in the signature values instead, so that identical
+// calls from different senders get different hashes.
+func newSimTransaction(config *params.ChainConfig, header *types.Header, msg *core.Message, nonce uint64) *types.Transaction {
+	var (
+		v = new(big.Int)
+		r = new(big.Int).SetBytes(msg.From.Bytes())
+		s = new(big.Int)
+	)
+	if header.BaseFee == nil {
+		return types.NewTx(&types.LegacyTx{
+			Nonce:    nonce,
+			GasPrice: msg.GasPrice,
+			Gas:      msg.GasLimit,
+			To:       msg.To,
+			Value:    msg.Value,
+			Data:     msg.Data,
+			V:        v,
+			R:        r,
+			S:        s,
+		})
+	}
+	return types.NewTx(&types.DynamicFeeTx{
+		ChainID:    config.ChainID,
+		Nonce:      nonce,
+		GasTipCap:  msg.GasTipCap,
+		GasFeeCap:  msg.GasFeeCap,
+		Gas:        msg.GasLimit,
+		To:         msg.To,
+		Value:      msg.Value,
+		Data:       msg.Data,
+		AccessList: msg.AccessList,
+		V:          v,
+		R:          r,
+		S:          s,
+	})
+}
+
+// newCallError converts the failure of a call into the error reported for it,
+// carrying the revert reason and data for reverts.
+func newCallError(result *core.ExecutionResult) *CallError {
+	if errors.Is(result.Err, vm.ErrExecutionReverted) {
+		revertErr := newRevertError(result.Revert())
+		return &CallError{
+			Message: revertErr.Error(),
+			Code:    revertErr.ErrorCode(),
+			Data:    revertErr.ErrorData().(string),
+		}
+	}
+	return &CallError{Message: result.Err.Error(), Code: errCodeVMError}
+}
+
+// SimulateV1 executes a series of transactions within the given blocks on top
+// of the state of the given block, the latest block by default. The chain is
+// never modified.
+func (s *BlockChainAPI) SimulateV1(ctx context.Context, opts SimOpts, blockNrOrHash *rpc.BlockNumberOrHash) ([]*SimBlockResult, error) {
+	bNrOrHash := rpc.BlockNumberOrHashWithNumber(rpc.LatestBlockNumber)
+	if blockNrOrHash != nil {
+		bNrOrHash = *blockNrOrHash
+	}
+	state, header, err := s.b.StateAndHeaderByNumberOrHash(ctx, bNrOrHash)
+	if state == nil || err != nil {
+		return nil, err
+	}
+	return Simulate(ctx, s.b.ChainConfig(), NewChainContext(ctx, s.b), state, header, &opts, s.b.RPCGasCap())
+}
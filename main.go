@@ -2,31 +2,186 @@ package main
 
 import (
 	"encoding/hex"
+	"ethereum-evm/core"
+	"ethereum-evm/core/rawdb"
 	"ethereum-evm/core/vm"
+	"ethereum-evm/eth"
+	"ethereum-evm/eth/tracers"
+	_ "ethereum-evm/eth/tracers/native"
+	"ethereum-evm/ethdb"
+	"ethereum-evm/ethdb/leveldb"
+	"ethereum-evm/internal/ethapi"
+	"ethereum-evm/miner"
+	"ethereum-evm/params"
+	"flag"
 	"math/big"
+	"net/http"
+	"os"
+	"path/filepath"
 
 	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/crypto"
 
 	"ethereum-evm/core/state"
 	"fmt"
 )
 
-// common.HexToHash("56e81f171bcc55a6ff8345e692c0f86e5b48e01b996cadc001622fb5e363b421")
-// func OpenDatabaseWithFreezer(name string, cache, handles int, freezer, namespace string, readonly bool) (ethdb.Database, error) {
-// 	var db ethdb.Database
-// 	var err error
-// 	db, err = rawdb.NewLevelDBDatabaseWithFreezer(root, cache, handles, freezer, namespace, readonly)
-// 	// if err == nil {
-// 	// 	db = n.wrapDatabase(db)
-// 	// }
-// 	retruen db, nil
-// }
+// gasLimit is the amount of gas handed to every top level call and create.
+const gasLimit = uint64(10000000)
+
+// datadir is where the LevelDB database holding the state lives. When empty
+// the state is kept in memory and is gone once the run ends.
+var datadir = flag.String("datadir", "db", "data directory of the state database, empty to keep the state in memory")
+
+// cache is the memory allowance in megabytes of the LevelDB caches.
+var cache = flag.Int("cache", 16, "megabytes of memory allocated to the database caches")
+
+// handles is the number of open files LevelDB is allowed to hold.
+var handles = flag.Int("handles", 16, "number of file handles allocated to the database")
+
+// headRootKey tracks the root of the last committed state, so that every run
+// continues from where the previous one stopped.
+var headRootKey = []byte("LastStateRoot")
+
+// step enables the interactive mode: the state is printed after every
+// instruction and execution waits for enter to be pressed.
+var step = flag.Bool("step", false, "print the state after every instruction and wait for enter")
+
+// jsonTrace writes an EIP-3155 trace of the execution to stderr.
+var jsonTrace = flag.Bool("json", false, "write an EIP-3155 JSON trace to stderr")
+
+// rawTx is a signed transaction, legacy or typed, to execute instead of the
+// built-in call.
+var rawTx = flag.String("tx", "", "hex encoded signed transaction to execute")
+
+// httpAddr is the listen address of the JSON-RPC server. When set a development
+// chain is served over HTTP instead of running the built-in call.
+var httpAddr = flag.String("http", "", "listen address of the HTTP JSON-RPC server, e.g. 127.0.0.1:8545")
+
+// devFaucet is the account funded in the genesis of the development chain. It
+// also receives the priority fees of the blocks sealed.
+var devFaucet = flag.String("dev.faucet", "0xf39Fd6e51aad88F6F4ce6aB8827279cffFb92266", "address funded in the development chain genesis")
+
+// devGasLimit is the gas limit of the development chain blocks.
+const devGasLimit = uint64(30000000)
+
+// rpcGasCap is the most gas a single eth_call or eth_estimateGas may use, and
+// the gas budget of all the calls of an eth_simulateV1 bundle together.
+const rpcGasCap = uint64(50000000)
+
+// newHeader returns the header of the block everything is executed in. Its
+// number and time decide, together with the chain config, which fork rules and
+// instruction set are active.
+func newHeader(root common.Hash) *types.Header {
+	return &types.Header{
+		Root:       root,
+		GasLimit:   30000000,
+		Number:     big.NewInt(17034870),
+		Time:       1681338455,
+		Difficulty: big.NewInt(0),
+		BaseFee:    big.NewInt(params.InitialBaseFee),
+	}
+}
+
+// newEVM creates an EVM on top of stateDB in the context of the block header.
+func newEVM(stateDB vm.StateDB, txCtx vm.TxContext) *vm.EVM {
+	blockCtx := core.NewEVMBlockContext(newHeader(common.Hash{}), nil)
+
+	// Nothing pays for gas yet, messages are run with zero fees like eth_call.
+	config := vm.Config{NoBaseFee: true}
+	if *step {
+		config.StepHook = vm.NewInteractiveStepHook(os.Stdin)
+	}
+	if *jsonTrace {
+		config.Debug = true
+		config.Tracer = vm.NewJSONLogger(nil, os.Stderr)
+	}
+	return vm.NewEVM(blockCtx, txCtx, stateDB, params.MainnetChainConfig, config)
+}
+
+// openDatabase opens the key-value store backing the state, on disk in the
+// configured data directory or in memory if there is none.
+func openDatabase() (ethdb.KeyValueStore, error) {
+	if *datadir == "" {
+		return leveldb.NewMemory()
+	}
+	return leveldb.New(*datadir, *cache, *handles, "", false)
+}
+
+// headRoot returns the root of the state committed by the previous run.
+func headRoot(db ethdb.KeyValueReader) common.Hash {
+	if enc, err := db.Get(headRootKey); err == nil {
+		return common.BytesToHash(enc)
+	}
+	return types.EmptyRootHash
+}
+
+// openState opens the state committed by the previous run.
+func openState() (*state.StateDB, ethdb.KeyValueStore, error) {
+	db, err := openDatabase()
+	if err != nil {
+		return nil, nil, err
+	}
+	stateDB, err := state.New(headRoot(db), state.NewDatabase(db))
+	if err != nil {
+		db.Close()
+		return nil, nil, err
+	}
+	return stateDB, db, nil
+}
+
+// commitState writes the changes made to stateDB to db and makes the new
+// state root the starting point of the next run.
+func commitState(stateDB *state.StateDB, db ethdb.KeyValueWriter) error {
+	root, err := stateDB.Commit(true)
+	if err != nil {
+		return err
+	}
+	if err := stateDB.Database().TrieDB().Commit(root, false, nil); err != nil {
+		return err
+	}
+	fmt.Println("state root: ", root)
+	return db.Put(headRootKey, root.Bytes())
+}
+
+// newMessage creates a zero fee message from caller with the next nonce of the
+// caller. A nil to creates a contract.
+func newMessage(stateDB *state.StateDB, caller common.Address, to *common.Address, data []byte) *core.Message {
+	return &core.Message{
+		From:      caller,
+		To:        to,
+		Nonce:     stateDB.GetNonce(caller),
+		Value:     new(big.Int),
+		GasLimit:  gasLimit,
+		GasPrice:  new(big.Int),
+		GasFeeCap: new(big.Int),
+		GasTipCap: new(big.Int),
+		Data:      data,
+	}
+}
+
+// applyMessage runs msg as a transaction on top of stateDB.
+func applyMessage(stateDB *state.StateDB, msg *core.Message) (*core.ExecutionResult, error) {
+	evm := newEVM(stateDB, core.NewEVMTxContext(msg))
+	gp := new(core.GasPool).AddGas(evm.Context.GasLimit)
+	return core.ApplyMessage(evm, msg, gp)
+}
+
+// openChainDatabase opens the database holding the chain, with old blocks
+// moved into the freezer in the ancient directory of the data directory. The
+// chain is kept in memory if there is no data directory.
+func openChainDatabase() (ethdb.Database, error) {
+	if *datadir == "" {
+		return rawdb.NewMemoryDatabase(), nil
+	}
+	return rawdb.NewLevelDBDatabaseWithFreezer(*datadir, *cache, *handles, filepath.Join(*datadir, "ancient"), "", false)
+}
 
 func disassembler() {
 	fmt.Println("######disassembler start######")
 	byteCodeStr := "608060405234801561001057600080fd5b5060408051808201909152600a81526912195b1b1bd5dbdc9b1960b21b602082015260009061003f90826100e4565b506101a3565b634e487b7160e01b600052604160045260246000fd5b600181811c9082168061006f57607f821691505b60208210810361008f57634e487b7160e01b600052602260045260246000fd5b50919050565b601f8211156100df57600081815260208120601f850160051c810160208610156100bc5750805b601f850160051c820191505b818110156100db578281556001016100c8565b5050505b505050565b81516001600160401b038111156100fd576100fd610045565b6101118161010b845461005b565b84610095565b602080601f831160018114610146576000841561012e5750858301515b600019600386901b1c1916600185901b1785556100db565b600085815260208120601f198616915b8281101561017557888601518255948401946001909101908401610156565b50858210156101935787850151600019600388901b60f8161c191681555b5050505050600190811b01905550565b6103a4806101b26000396000f3fe608060405234801561001057600080fd5b50600436106100365760003560e01c8063a41368621461003b578063cfae321714610050575b600080fd5b61004e610049366004610126565b61006e565b005b61005861007e565b60405161006591906101d7565b60405180910390f35b600061007a82826102ae565b5050565b60606000805461008d90610225565b80601f01602080910402602001604051908101604052809291908181526020018280546100b990610225565b80156101065780601f106100db57610100808354040283529160200191610106565b820191906000526020600020905b8154815290600101906020018083116100e957829003601f168201915b5050505050905090565b634e487b7160e01b600052604160045260246000fd5b60006020828403121561013857600080fd5b813567ffffffffffffffff8082111561015057600080fd5b818401915084601f83011261016457600080fd5b81358181111561017657610176610110565b604051601f8201601f19908116603f0116810190838211818310171561019e5761019e610110565b816040528281528760208487010111156101b757600080fd5b826020860160208301376000928101602001929092525095945050505050565b600060208083528351808285015260005b81811015610204578581018301518582016040015282016101e8565b506000604082860101526040601f19601f8301168501019250505092915050565b600181811c9082168061023957607f821691505b60208210810361025957634e487b7160e01b600052602260045260246000fd5b50919050565b601f8211156102a957600081815260208120601f850160051c810160208610156102865750805b601f850160051c820191505b818110156102a557828155600101610292565b5050505b505050565b815167ffffffffffffffff8111156102c8576102c8610110565b6102dc816102d68454610225565b8461025f565b602080601f83116001811461031157600084156102f95750858301515b600019600386901b1c1916600185901b1785556102a5565b600085815260208120601f198616915b8281101561034057888601518255948401946001909101908401610321565b508582101561035e5787850151600019600388901b60f8161c191681555b5050505050600190811b0190555056fea264697066735822122004957a2054347f8181f8f40fd80c5fcd53272c8d61a0f48df1ec4b18597d595064736f6c63430008110033"
-	stateDB, _ := state.New(common.HexToHash("56e81f171bcc55a6ff8345e692c0f86e5b48e01b996cadc001622fb5e363b421"))
-	evm := vm.NewEVM(stateDB)
+	evm := newEVM(nil, vm.TxContext{})
 	evm.Interpreter().Disassembler(byteCodeStr)
 	fmt.Println("######disassembler end######")
 }
@@ -45,9 +200,23 @@ func createContract() {
 	fmt.Println("caller address: ", caller)
 	fmt.Println("caller address: ", vm.AccountRef(caller).Address())
 
-	stateDB, _ := state.New(common.HexToHash("56e81f171bcc55a6ff8345e692c0f86e5b48e01b996cadc001622fb5e363b421"))
-	evm := vm.NewEVM(stateDB)
-	evm.Create(vm.AccountRef(caller), byteCodes, 0, big.NewInt(0))
+	stateDB, db, err := openState()
+	if err != nil {
+		fmt.Println("failed to open state:", err)
+		return
+	}
+	defer db.Close()
+	msg := newMessage(stateDB, caller, nil, byteCodes)
+	result, err := applyMessage(stateDB, msg)
+	if err != nil {
+		fmt.Println("failed to apply message:", err)
+		return
+	}
+	contractAddr := crypto.CreateAddress(caller, msg.Nonce)
+	fmt.Println("contract address: ", contractAddr, "gas used: ", result.UsedGas, "err: ", result.Err)
+	if err := commitState(stateDB, db); err != nil {
+		fmt.Println("failed to commit state:", err)
+	}
 }
 
 func call() {
@@ -57,14 +226,115 @@ func call() {
 	caller := common.HexToAddress("0xDf40D489563D6040daa47c87Cd785EcE2cB8d4a8")
 	contractAddress := common.HexToAddress("0x54B62465192101eeF3fDC3eD6dde7E2ccbe0F51B")
 
-	stateDB, _ := state.New(common.HexToHash("56e81f171bcc55a6ff8345e692c0f86e5b48e01b996cadc001622fb5e363b421"))
-	evm := vm.NewEVM(stateDB)
-	evm.Call(vm.AccountRef(caller), contractAddress, greetCode, 0, big.NewInt(0))
+	stateDB, db, err := openState()
+	if err != nil {
+		fmt.Println("failed to open state:", err)
+		return
+	}
+	defer db.Close()
+	// There is no transaction yet, identify the logs of this call by its input.
+	txHash := crypto.Keccak256Hash(caller.Bytes(), contractAddress.Bytes(), greetCode)
+	stateDB.Prepare(txHash, 0)
+	result, err := applyMessage(stateDB, newMessage(stateDB, caller, &contractAddress, greetCode))
+	if err != nil {
+		fmt.Println("failed to apply message:", err)
+		return
+	}
+	fmt.Printf("ret: %x gas used: %d err: %v\n", result.ReturnData, result.UsedGas, result.Err)
+
+	receipt := core.NewReceipt(stateDB, txHash, result.Failed(), result.UsedGas, result.UsedGas)
+	for _, log := range receipt.Logs {
+		fmt.Printf("log: address %s topics %v data %x\n", log.Address, log.Topics, log.Data)
+	}
+	if err := commitState(stateDB, db); err != nil {
+		fmt.Println("failed to commit state:", err)
+	}
+}
+
+// sendTransaction executes a signed transaction on top of the committed state.
+// The sender is recovered with the signer of the configured block, which must
+// be able to pay for the gas at the offered price.
+func sendTransaction(raw string) {
+	tx, err := core.DecodeTransaction(common.FromHex(raw))
+	if err != nil {
+		fmt.Println("failed to decode transaction:", err)
+		return
+	}
+	stateDB, db, err := openState()
+	if err != nil {
+		fmt.Println("failed to open state:", err)
+		return
+	}
+	defer db.Close()
+	evm := newEVM(stateDB, vm.TxContext{})
+	signer := core.MakeSigner(evm.ChainConfig(), evm.Context.BlockNumber)
+	msg, err := core.TransactionToMessage(tx, signer, evm.Context.BaseFee)
+	if err != nil {
+		fmt.Println("failed to recover sender:", err)
+		return
+	}
+	fmt.Println("tx hash: ", tx.Hash(), "type: ", tx.Type(), "from: ", msg.From)
+
+	stateDB.Prepare(tx.Hash(), 0)
+	evm.Reset(core.NewEVMTxContext(msg), stateDB)
+	result, err := core.ApplyMessage(evm, msg, new(core.GasPool).AddGas(evm.Context.GasLimit))
+	if err != nil {
+		fmt.Println("failed to apply transaction:", err)
+		return
+	}
+	fmt.Printf("ret: %x gas used: %d err: %v\n", result.ReturnData, result.UsedGas, result.Err)
+
+	receipt := core.NewReceipt(stateDB, tx.Hash(), result.Failed(), result.UsedGas, result.UsedGas)
+	for _, log := range receipt.Logs {
+		fmt.Printf("log: address %s topics %v data %x\n", log.Address, log.Topics, log.Data)
+	}
+	if err := commitState(stateDB, db); err != nil {
+		fmt.Println("failed to commit state:", err)
+	}
+}
+
+// serveHTTP runs a development chain and serves the JSON-RPC APIs over HTTP
+// until the server fails. Every transaction received is sealed into a block
+// right away.
+func serveHTTP(addr string) {
+	db, err := openChainDatabase()
+	if err != nil {
+		fmt.Println("failed to open database:", err)
+		return
+	}
+	defer db.Close()
+	faucet := common.HexToAddress(*devFaucet)
+	chain, err := core.NewBlockChain(db, core.DeveloperGenesisBlock(devGasLimit, faucet), vm.Config{})
+	if err != nil {
+		fmt.Println("failed to open chain:", err)
+		return
+	}
+	backend := eth.NewEthAPIBackend(chain, miner.New(chain, faucet), rpcGasCap)
+	server, err := ethapi.NewServer(append(ethapi.GetAPIs(backend), tracers.APIs(backend)...))
+	if err != nil {
+		fmt.Println("failed to create rpc server:", err)
+		return
+	}
+	defer server.Stop()
+
+	fmt.Println("serving JSON-RPC on", addr, "at block", chain.CurrentBlock().NumberU64())
+	if err := http.ListenAndServe(addr, server); err != nil {
+		fmt.Println("rpc server failed:", err)
+	}
 }
 
 // 0x54B62465192101eeF3fDC3eD6dde7E2ccbe0F51B
 func main() {
+	flag.Parse()
 	fmt.Println("hello world")
+	if *httpAddr != "" {
+		serveHTTP(*httpAddr)
+		return
+	}
+	if *rawTx != "" {
+		sendTransaction(*rawTx)
+		return
+	}
 	call()
 }
 
@@ -0,0 +1,90 @@
+// Package miner implements instant block sealing for development chains.
+package miner
+
+import (
+	"ethereum-evm/consensus/misc"
+	"ethereum-evm/core"
+	"ethereum-evm/core/vm"
+	"ethereum-evm/trie"
+	"math/big"
+	"sync"
+	"time"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core/types"
+)
+
+// Miner seals every transaction it is handed into a block of its own on top of
+// the chain head, the way development nodes mine on demand.
+type Miner struct {
+	chain    *core.BlockChain
+	coinbase common.Address
+
+	mu sync.Mutex // Serialises block production
+}
+
+// New creates a miner sealing blocks on top of chain. The coinbase receives the
+// priority fees of the sealed transactions.
+func New(chain *core.BlockChain, coinbase common.Address) *Miner {
+	return &Miner{
+		chain:    chain,
+		coinbase: coinbase,
+	}
+}
+
+// prepareHeader creates the header of the block following parent.
+func (m *Miner) prepareHeader(parent *types.Block) *types.Header {
+	config := m.chain.Config()
+	timestamp := uint64(time.Now().Unix())
+	if timestamp <= parent.Time() {
+		timestamp = parent.Time() + 1
+	}
+	header := &types.Header{
+		ParentHash: parent.Hash(),
+		Number:     new(big.Int).Add(parent.Number(), common.Big1),
+		GasLimit:   parent.GasLimit(),
+		Time:       timestamp,
+		Coinbase:   m.coinbase,
+		Difficulty: new(big.Int),
+	}
+	if config.IsLondon(header.Number) {
+		header.BaseFee = misc.CalcBaseFee(config, parent.Header())
+	}
+	if config.IsShanghai(header.Number, header.Time) {
+		header.WithdrawalsHash = &types.EmptyWithdrawalsHash
+	}
+	return header
+}
+
+// SealTransaction executes tx on top of the chain head and appends a block
+// holding only tx to the chain. Transactions that can't be included, because
+// of a wrong nonce or insufficient funds for example, are rejected without
+// producing a block.
+func (m *Miner) SealTransaction(tx *types.Transaction) (*types.Block, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	parent := m.chain.CurrentBlock()
+	statedb, err := m.chain.StateAt(parent.Root())
+	if err != nil {
+		return nil, err
+	}
+	header := m.prepareHeader(parent)
+	txs := types.Transactions{tx}
+
+	result, err := m.chain.Processor().Process(types.NewBlockWithHeader(header).WithBody(txs, nil), statedb, vm.Config{})
+	if err != nil {
+		return nil, err
+	}
+	header.GasUsed = result.GasUsed
+	header.Root = result.Root
+
+	block := types.NewBlock(header, txs, nil, result.Receipts, trie.NewStackTrie(nil))
+	if header.WithdrawalsHash != nil {
+		block = block.WithWithdrawals(make([]*types.Withdrawal, 0))
+	}
+	if err := m.chain.WriteBlockAndSetHead(block, result.Receipts, statedb); err != nil {
+		return nil, err
+	}
+	return block, nil
+}
@@ -0,0 +1,257 @@
+// Copyright 2014 The go-ethereum Authors
+// This file is part of the go-ethereum library.
+//
+// The go-ethereum library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-ethereum library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-ethereum library. If not, see <http://www.gnu.org/licenses/>.
+
+package trie
+
+import (
+	"bytes"
+	"ethereum-evm/ethdb/memorydb"
+	"testing"
+
+	"github.com/ethereum/go-ethereum/common"
+)
+
+// Used for testing
+func newEmpty() *Trie {
+	trie, _ := New(common.Hash{}, NewDatabase(memorydb.New()))
+	return trie
+}
+
+func TestEmptyTrie(t *testing.T) {
+	var trie Trie
+	res := trie.Hash()
+	exp := emptyRoot
+	if res != exp {
+		t.Errorf("expected %x got %x", exp, res)
+	}
+}
+
+func TestNull(t *testing.T) {
+	var trie Trie
+	key := make([]byte, 32)
+	value := []byte("test")
+	trie.Update(key, value)
+	if !bytes.Equal(trie.Get(key), value) {
+		t.Fatal("wrong value")
+	}
+}
+
+func TestMissingRoot(t *testing.T) {
+	trie, err := New(common.HexToHash("0beec7b5ea3f0fdbc95d0dd47f3c5bc275da8a33"), NewDatabase(memorydb.New()))
+	if trie != nil {
+		t.Error("New returned non-nil trie for invalid root")
+	}
+	if _, ok := err.(*MissingNodeError); !ok {
+		t.Errorf("New returned wrong error: %v", err)
+	}
+}
+
+func TestInsert(t *testing.T) {
+	trie := newEmpty()
+
+	updateString(trie, "doe", "reindeer")
+	updateString(trie, "dog", "puppy")
+	updateString(trie, "dogglesworth", "cat")
+
+	exp := common.HexToHash("8aad789dff2f538bca5d8ea56e8abe10f4c7ba3a5dea95fea4cd6e7c3a1168d3")
+	root := trie.Hash()
+	if root != exp {
+		t.Errorf("case 1: exp %x got %x", exp, root)
+	}
+
+	trie = newEmpty()
+	updateString(trie, "A", "aaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaa")
+
+	exp = common.HexToHash("d23786fb4a010da3ce639d66d5e904a11dbc02746d1ce25029e53290cabf28ab")
+	root, err := trie.Commit(nil)
+	if err != nil {
+		t.Fatalf("commit error: %v", err)
+	}
+	if root != exp {
+		t.Errorf("case 2: exp %x got %x", exp, root)
+	}
+}
+
+func TestGet(t *testing.T) {
+	trie := newEmpty()
+	updateString(trie, "doe", "reindeer")
+	updateString(trie, "dog", "puppy")
+	updateString(trie, "dogglesworth", "cat")
+
+	for i := 0; i < 2; i++ {
+		res := getString(trie, "dog")
+		if !bytes.Equal(res, []byte("puppy")) {
+			t.Errorf("expected puppy got %x", res)
+		}
+
+		unknown := getString(trie, "unknown")
+		if unknown != nil {
+			t.Errorf("expected nil got %x", unknown)
+		}
+
+		if i == 1 {
+			return
+		}
+		trie.Commit(nil)
+	}
+}
+
+func TestDelete(t *testing.T) {
+	trie := newEmpty()
+	vals := []struct{ k, v string }{
+		{"do", "verb"},
+		{"ether", "wookiedoo"},
+		{"horse", "stallion"},
+		{"shaman", "horse"},
+		{"doge", "coin"},
+		{"ether", ""},
+		{"dog", "puppy"},
+		{"shaman", ""},
+	}
+	for _, val := range vals {
+		if val.v != "" {
+			updateString(trie, val.k, val.v)
+		} else {
+			deleteString(trie, val.k)
+		}
+	}
+
+	hash := trie.Hash()
+	exp := common.HexToHash("5991bb8c6514148a29db676a14ac506cd2cd5775ace63c30a4fe457715e9ac84")
+	if hash != exp {
+		t.Errorf("expected %x got %x", exp, hash)
+	}
+}
+
+func TestReplication(t *testing.T) {
+	trie := newEmpty()
+	vals := []struct{ k, v string }{
+		{"do", "verb"},
+		{"ether", "wookiedoo"},
+		{"horse", "stallion"},
+		{"shaman", "horse"},
+		{"doge", "coin"},
+		{"dog", "puppy"},
+		{"somethingveryoddindeedthis is", "myothernodedata"},
+	}
+	for _, val := range vals {
+		updateString(trie, val.k, val.v)
+	}
+	exp, err := trie.Commit(nil)
+	if err != nil {
+		t.Fatalf("commit error: %v", err)
+	}
+
+	// create a new trie on top of the database and check that lookups work.
+	trie2, err := New(exp, trie.db)
+	if err != nil {
+		t.Fatalf("can't recreate trie at %x: %v", exp, err)
+	}
+	for _, kv := range vals {
+		if string(getString(trie2, kv.k)) != kv.v {
+			t.Errorf("trie2 doesn't have %q => %q", kv.k, kv.v)
+		}
+	}
+	hash, err := trie2.Commit(nil)
+	if err != nil {
+		t.Fatalf("commit error: %v", err)
+	}
+	if hash != exp {
+		t.Errorf("root failure. expected %x got %x", exp, hash)
+	}
+}
+
+// Tests that committed nodes stay in memory until the trie database is
+// flushed, after which they are served from disk.
+func TestDatabaseCommit(t *testing.T) {
+	diskdb := memorydb.New()
+	triedb := NewDatabase(diskdb)
+
+	trie, _ := New(common.Hash{}, triedb)
+	updateString(trie, "120000", "qwerqwerqwerqwerqwerqwerqwerqwer")
+	updateString(trie, "123456", "asdfasdfasdfasdfasdfasdfasdfasdf")
+	root, _ := trie.Commit(nil)
+
+	if ok, _ := diskdb.Has(root[:]); ok {
+		t.Fatalf("root node written to disk before flush")
+	}
+	if len(triedb.Nodes()) == 0 {
+		t.Fatalf("no dirty nodes cached after commit")
+	}
+	if err := triedb.Commit(root, false, nil); err != nil {
+		t.Fatalf("failed to flush trie: %v", err)
+	}
+	if ok, _ := diskdb.Has(root[:]); !ok {
+		t.Fatalf("root node missing from disk after flush")
+	}
+	if nodes := triedb.Nodes(); len(nodes) != 0 {
+		t.Fatalf("dirty nodes left after flush: %d", len(nodes))
+	}
+	trie, err := New(root, NewDatabase(diskdb))
+	if err != nil {
+		t.Fatalf("can't reopen trie at %x: %v", root, err)
+	}
+	if v := getString(trie, "123456"); string(v) != "asdfasdfasdfasdfasdfasdfasdfasdf" {
+		t.Errorf("wrong value after reopen: %q", v)
+	}
+}
+
+// Tests that dereferencing a root garbage collects all of its unshared nodes
+// without touching the disk.
+func TestDatabaseDereference(t *testing.T) {
+	diskdb := memorydb.New()
+	triedb := NewDatabase(diskdb)
+
+	trie, _ := New(common.Hash{}, triedb)
+	updateString(trie, "doe", "reindeer")
+	updateString(trie, "dog", "puppy")
+	updateString(trie, "dogglesworth", "cat")
+	root, _ := trie.Commit(nil)
+
+	triedb.Reference(root, common.Hash{})
+	triedb.Dereference(root)
+
+	if nodes := triedb.Nodes(); len(nodes) != 0 {
+		t.Fatalf("dirty nodes left after dereference: %d", len(nodes))
+	}
+	if size, _ := triedb.Size(); size != 0 {
+		t.Fatalf("dirty cache size not reset: %v", size)
+	}
+	if ok, _ := diskdb.Has(root[:]); ok {
+		t.Fatalf("garbage collected root written to disk")
+	}
+}
+
+// Tests that the trie database returns a missing trie node error if attempting
+// to retrieve the meta root.
+func TestDatabaseMetarootFetch(t *testing.T) {
+	db := NewDatabase(memorydb.New())
+	if _, err := db.Node(common.Hash{}); err == nil {
+		t.Fatalf("metaroot retrieval succeeded")
+	}
+}
+
+func getString(trie *Trie, k string) []byte {
+	return trie.Get([]byte(k))
+}
+
+func updateString(trie *Trie, k, v string) {
+	trie.Update([]byte(k), []byte(v))
+}
+
+func deleteString(trie *Trie, k string) {
+	trie.Delete([]byte(k))
+}